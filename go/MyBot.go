@@ -2,189 +2,228 @@ package main
 
 import (
 	"os"
+	"sort"
 )
 
+// MyBot routes ants two ways. Each live goal has a GoalSearch covering
+// the squares within SearchThreshold steps of it, and the ants those
+// searches reach are paired off with goals by Assign. The DistanceFields
+// in s.Fields cover the whole map, one per goal type, and are only
+// consulted for the ants Assign leaves over (see route).
 type MyBot struct {
+	config    *Config
 	goalQueue *SearchQueue
 }
 
 //NewBot creates a new instance of your bot
-func NewBot(s *State) Bot {
+func NewBot(s *State, config *Config) Bot {
 	mb := new(MyBot)
+	mb.config = config
+	s.Config = config
 	mb.goalQueue = NewSearchQueue()
-	s.ObservedSquares = make(SquareSet)
-	s.LivingAnts = make(map[int]*Ant)
+	s.Fields = map[GoalType]*DistanceField{
+		EatType:     NewDistanceField(s, EatType, mb.goalQueue),
+		ExploreType: NewDistanceField(s, ExploreType, mb.goalQueue),
+		RazeType:    NewDistanceField(s, RazeType, mb.goalQueue),
+	}
+	s.Searches = make(map[GoalId]*GoalSearch)
+	s.Analysis = NewMapAnalysis(s)
 
-	Log.Printf("New bot created!")
+	Log.Printf("Goals: New bot created!")
 
 	return mb
 }
 
 //DoTurn is where you should do your bot's actual work.
 func (mb *MyBot) DoTurn(s *State) os.Error {
+	mb.goalQueue.NextTurn()
 	Log.Printf("BFS: Search queue has size %v (from previous turns)", mb.goalQueue.Len())
 
-	// Update map visibility
-	Log.Printf("Updating visiblity for %v ants", len(s.LivingAnts))
-	updated := 0
-	for _, ant := range s.LivingAnts {
-		updated += ant.square.Visit(s)
-	}
-	Log.Printf("Updated visiblity of %v squares", updated)
-
-	// restore any newly visible squares to the goalQueue if they were previously set aside
-	restoredSearchNodes := 0
-	// TODO have an index of newly observed squares to avoid walking all?
-	for _, square := range s.ObservedSquares {
-		for _, searchNode := range square.deferredSearchNodes {
-			mb.goalQueue.Push(searchNode)
-			restoredSearchNodes++
-		}
+	// Map visibility was updated for our ants' new positions as the turn began
+	Log.Printf("Visibility: %v squares came into view (%v for the first time), %v went out of view",
+		len(s.Visibility.NewlyVisible), len(s.Visibility.NewlyObserved), len(s.Visibility.NewlyHidden))
 
-		square.deferredSearchNodes = make([]*SearchNode, 0)
+	// extend the distance fields and goal searches into newly observed squares
+	for _, square := range s.Visibility.NewlyObserved {
+		for _, field := range s.Fields {
+			field.Observe(square)
+		}
+		for _, search := range s.Searches {
+			search.SquareChanged(square)
+		}
 	}
-	Log.Printf("BFS: Restored %v deferred search nodes from previous turns", restoredSearchNodes)
+	Log.Printf("BFS: Search queue has size %v after observing new squares", mb.goalQueue.Len())
 
 	// Compute game statistics for weighting model
 	s.Stats.Update(s)
-	Log.Printf("Current turn statistics are %+v", s.Stats)
+	Log.Printf("Stats: Current turn statistics are %+v", s.Stats)
+
+	// Work out the map's symmetry to predict unseen terrain and enemy hills
+	s.Analysis.Update(s.Budget.Begin("analysis", mb.config.AnalysisBudget))
 
 	// Make a shared list of goals used by all ants
 	// TODO can skip this until we actually need to pick a goal
-	Log.Printf("Looking for goals")
+	s.Budget.Begin("goals", 0)
+	Log.Printf("Goals: Looking for goals")
 	s.GenerateGoals()
 
-	// Loop over all goals and seed them into the search queue if new, or clean them up if invalid
+	// Loop over all goals and seed them into their distance field and a
+	// search of their own if new, or clean them up if invalid
+	liveGoals := make(GoalList, 0)
+	logBFS := Log.Enabled("BFS", LogDebug)
 	for _, goal := range AllGoals {
-		square := goal.Destination()
-		if !square.HasGoal(goal) {
-			// Goal is new
-			route := make(Route, 0)
-			newNode := NewSearchNode(square, goal, route)
-			Log.Printf("BFS: Adding seed node: %+v", newNode)
-			mb.goalQueue.Push(newNode)
-		} else if !goal.IsValid() {
+		field := s.Fields[goal.GoalType()]
+		if !goal.IsValid() {
 			// Goal should quiesce
+			field.RemoveTarget(goal)
+			s.Searches[goal.Id()] = nil, false
 			goal.Die()
-		} // else do nothing to goal
-	}
+			s.Telemetry.Count("goals_died", 1)
+			continue
+		}
 
-	Log.Printf("Search queue has size %v after goal generation", mb.goalQueue.Len())
+		if !field.HasTarget(goal) {
+			// Goal is new
+			if logBFS {
+				Log.Printf("BFS: Adding target: %v", goal)
+			}
+			field.AddTarget(goal)
+			s.Searches[goal.Id()] = NewGoalSearch(goal, mb.config.SearchThreshold)
+			s.Telemetry.Count("goals_created", 1)
+		}
 
-	// hack to limit memory usage
-	// TODO make this a function of the goal type? are we ever going to be able to remove this?
-	maxSearchRadius := 12
+		liveGoals = append(liveGoals, goal)
+	}
 
-	// stats
-	searchRadius := 0
-	searchCount := 0
+	Log.Printf("BFS: Search queue has size %v after goal generation", mb.goalQueue.Len())
 
-	searchTimeNanos := (int64)(s.TurnTime * 800000)
-	RunTimeoutLoop(searchTimeNanos, func() bool {
-		if mb.goalQueue.Len() == 0 {
+	// Invert routing: bring each goal's search up to date and collect the
+	// ants within range of it, most important goals first in case we time
+	// out. One search can take a while, so check the clock after each.
+	sort.Sort(liveGoals)
+	candidates := make(CandidateList, 0)
+	searchedGoals := 0
+	s.Budget.Begin("search", mb.config.SearchBudget).CheckEvery(1).Loop(func() bool {
+		if searchedGoals == len(liveGoals) {
 			return false // stop looping
 		}
 
-		// visit the first node in the queue and unpack it
-		node := mb.goalQueue.Pop()
-		nodeSearchRadius := len(node.route)
-		if nodeSearchRadius >= searchRadius {
-			searchRadius = nodeSearchRadius
-		} else {
-			panic("search is not breadth-first!")
-		}
-		searchCount++
+		search := s.Searches[liveGoals[searchedGoals].Id()]
+		search.Compute()
+		candidates = append(candidates, search.Candidates(s.LivingAnts)...)
+		searchedGoals++
 
-		//Log.Printf("BFS searching %+v", node)
-		square, goal, route := node.square, node.goal, node.route
-
-		// Purge from queue if no longer valid
-		if !goal.IsValid() {
-			return true // next iteration
-		}
+		return true // continue looping
+	})
 
-		// Record the route to this goal on the square
-		square.goals[goal.Id()] = route
+	s.Budget.Begin("assign", 0)
+	assignments := candidates.Assign()
+	s.Telemetry.Count("goals_searched", searchedGoals)
+	s.Telemetry.Count("candidates", len(candidates))
+	Log.Printf("Candidates: searched %v of %v goals, found %v candidates, assigned %v ants", searchedGoals, len(liveGoals), len(candidates), len(assignments))
 
-		// don't search any further from this node if we've maxed out
-		if nodeSearchRadius >= maxSearchRadius {
-			return true
+	// Keep the distance fields up to date for ants that no goal claimed
+	searchCount := 0
+	s.Budget.Begin("fields", mb.config.FieldBudget).Loop(func() bool {
+		if mb.goalQueue.Len() == 0 {
+			return false // stop looping
 		}
 
-		// put neighboring squares at end of search queue
-		for _, neighbor := range square.Neighbors() {
-			//Log.Printf("BFS: looking for new search node at %v", neighbor)
-
-			// Don't enqueue the neighbor if we've already visited it for this goal
-			if neighbor.HasGoal(goal) {
-				//Log.Printf("BFS: skipping already visited square %v", neighbor)
-			} else {
-				newRoute := make(Route, 0)
-				newRoute = append(newRoute, square)
-				newRoute = append(newRoute, route...)
-				newNode := NewSearchNode(neighbor, goal, newRoute)
-
-				// Don't try to search nodes we haven't observed yet (they could
-				// be water). Instead, set aside those nodes and restore them
-				// later
-				if !neighbor.observed {
-					//Log.Printf("BFS: skipping unobserved square %v", neighbor)
-					neighbor.deferredSearchNodes = append(neighbor.deferredSearchNodes, newNode)
-				} else {
-					//Log.Printf("BFS: Adding new node: %+v", newNode)
-					mb.goalQueue.Push(newNode)
-				}
-			}
-		}
+		node := mb.goalQueue.Pop()
+		s.Fields[node.goal.GoalType()].Visit(node)
+		searchCount++
 
 		return true // continue looping
 	})
 
-	// TODO restore the plug goal?
-	Log.Printf("BFS: done searching. Search count was %v, radius was at most %v square from goals", searchCount, searchRadius)
+	s.Telemetry.Count("bfs_nodes", searchCount)
+	s.Telemetry.Count("deferred_nodes", mb.goalQueue.Deferred)
+	Log.Printf("BFS: done searching. Search count was %v, %v nodes left for later turns", searchCount, mb.goalQueue.Len())
 
-	// Issue orders for each ant's best-available goal
+	// Issue orders for each ant's best-available goal, for as long as
+	// we've got time; any ants left over stay where they are
 	// TODO this should be treated as a queue, not an array
+	orders := s.Budget.Begin("orders", 0)
+	logOrders := Log.Enabled("Orders", LogDebug)
 	for _, ant := range s.LivingAnts {
+		if !orders.Continue() {
+			Log.Printf("Orders: out of time, %v ants left without orders", len(s.LivingAnts)-orders.Iterations)
+			break
+		}
+		orders.Iterations++
+
 		// check passable squares
 		square := ant.square
 		passable := square.Neighbors().Minus(square.Blacklist())
 
-		// try to assign a goal if we don't have one
-		if ant.goal == nil {
+		route := mb.route(s, ant, assignments, passable)
+		if logOrders {
+			Log.Printf("Orders: route for %v is %v", ant, route)
+		}
+		next := route.NextSquare()
+		if next != nil && passable.Member(next) {
+			ant.OrderTo(s, next)
+			s.Telemetry.Count("ants_ordered", 1)
+		} else if logOrders {
+			Log.Printf("Orders: Route is impassable, doing nothing")
+		}
+	}
+
+	//returning an error will halt the whole program!
+	return nil
+}
+
+// route picks the goal ant should pursue this turn and the way there. An
+// ant a goal's search picked goes to that goal. The distance fields are
+// the fallback for the rest: ants farther than SearchThreshold from
+// every goal, ants whose nearby goals all went to better candidates,
+// and ants near goals whose searches ran out of time this turn. An ant
+// that no field reaches either wanders.
+func (mb *MyBot) route(s *State, ant *Ant, assignments map[int]*Candidate, passable SquareSet) *Route {
+	if candidate, ok := assignments[ant.id]; ok {
+		// a nearby goal picked this ant
+		ant.SetGoal(candidate.goal)
+		return candidate.Route()
+	}
+
+	// nothing nearby wants this ant; find a goal at any range if we
+	// don't have one, or if the field now leads somewhere else
+	square := ant.square
+	if ant.goal == nil || s.Fields[ant.goal.GoalType()].GoalAt(square) != ant.goal {
+		if Log.Enabled("Orders", LogDebug) {
 			Log.Printf("Orders: finding new orders for %v", ant)
+		}
 
-			// Iterate through all the square's goals and find the highest priority passable route
-			var bestGoal Goal = nil
-			for goalId, route := range square.goals {
-				passableRoute := (len(route) == 0) || passable.Member(route[0])
-				goal := goalId.Goal()
-				if passableRoute && (bestGoal == nil || goal.Priority() > bestGoal.Priority()) {
-					// TODO break priority ties by route length
-					bestGoal = goal
-				}
+		// Look at the nearest target of each goal type and find the highest priority passable route
+		var bestGoal Goal = nil
+		bestDistance := 0
+		for _, field := range s.Fields {
+			goal := field.GoalAt(square)
+			if goal == nil {
+				continue
 			}
 
-			ant.SetGoal(bestGoal)
+			next := field.NextStep(square)
+			passableRoute := (next == nil) || passable.Member(next)
+			distance := field.Distance(square)
+			if passableRoute && (bestGoal == nil || goal.Priority() > bestGoal.Priority() ||
+				(goal.Priority() == bestGoal.Priority() && distance < bestDistance)) {
+				bestGoal = goal
+				bestDistance = distance
+			}
 		}
 
-		// Execute either the assigned route or a random one
-		var route Route = nil
-		if ant.goal == nil {
-			route = PickWanderForAnt(s, ant)
-		} else {
-			route = ant.Route()
-		}
+		ant.SetGoal(bestGoal)
+	}
 
-		Log.Printf("Orders: route for %v is %v", ant, route)
-		passableRoute := (len(route) == 0) || passable.Member(route[0])
-		if len(route) > 0 && passableRoute {
-			ant.OrderTo(s, route[0])
-		} else {
-			Log.Printf("Route is impassable, doing nothing")
-		}
+	// Execute either the field's route or a random one
+	if ant.goal == nil {
+		return PickWanderForAnt(s, ant)
 	}
+	return ant.Route()
+}
 
-	//returning an error will halt the whole program!
-	return nil
+//EndGame is called with the final scores once the game is over
+func (mb *MyBot) EndGame(s *State, result *GameResult) {
+	Log.Infof("Game: Game over after %v turns with scores %v; we came %v of %v", result.Turn, result.Scores, result.Rank(), result.Players)
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// A corridor with explore goals at columns 5 and 30 and a walled-in
+// square at column 65
+var routeCorridor = []string{
+	strings.Repeat(".", 65) + "%....",
+	strings.Repeat(".", 64) + "%.%...",
+	strings.Repeat(".", 65) + "%....",
+}
+
+// TestRouteFallback checks which ants the distance fields route: only
+// those no goal's search picked
+func TestRouteFallback(t *testing.T) {
+	ResetGoals()
+	AllItems = make(ItemSet)
+	s := textState(routeCorridor...)
+	s.LivingAnts = make(map[int]*Ant)
+
+	config := DefaultConfig()
+	config.SearchThreshold = 10
+	mb := NewBot(s, config).(*MyBot)
+
+	near := NewExplore(s.SquareAtRowCol(1, 5))
+	far := NewExplore(s.SquareAtRowCol(1, 30))
+	picked := s.NewAnt(s.SquareAtRowCol(1, 3))   // 2 steps from near
+	beaten := s.NewAnt(s.SquareAtRowCol(1, 8))   // 3 steps from near
+	distant := s.NewAnt(s.SquareAtRowCol(1, 50)) // 20 steps from far
+	walled := s.NewAnt(s.SquareAtRowCol(1, 65))
+
+	candidates := make(CandidateList, 0)
+	for _, goal := range []Goal{near, far} {
+		s.Fields[ExploreType].AddTarget(goal)
+		search := NewGoalSearch(goal, config.SearchThreshold)
+		search.Compute()
+		candidates = append(candidates, search.Candidates(s.LivingAnts)...)
+	}
+	for mb.goalQueue.Len() > 0 {
+		node := mb.goalQueue.Pop()
+		s.Fields[node.goal.GoalType()].Visit(node)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("candidates %v, want the two ants near %v", candidates, near)
+	}
+	assignments := candidates.Assign()
+
+	tests := []struct {
+		ant  *Ant
+		goal Goal
+		next *Square
+	}{
+		{picked, near, s.SquareAtRowCol(1, 4)},  // by the search
+		{beaten, near, s.SquareAtRowCol(1, 7)},  // by the field, as near went to picked
+		{distant, far, s.SquareAtRowCol(1, 49)}, // by the field, out of reach of every search
+		{walled, nil, nil},                      // by nothing
+	}
+	for _, test := range tests {
+		ant := test.ant
+		route := mb.route(s, ant, assignments, ant.square.Neighbors().Minus(ant.square.Blacklist()))
+		if ant.goal != test.goal {
+			t.Errorf("%v: goal %v, want %v", ant, ant.goal, test.goal)
+		}
+		if _, assigned := assignments[ant.id]; assigned != (ant == picked) {
+			t.Errorf("%v: assigned is %v", ant, assigned)
+		}
+		if test.next != nil && route.NextSquare() != test.next {
+			t.Errorf("%v: route %v, want it to go to %v", ant, route, test.next)
+		}
+	}
+}
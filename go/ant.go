@@ -54,12 +54,12 @@ func (ant *Ant) Die(state *State) {
 
 // nil is a valid argument here (is this a good idea?)
 func (ant *Ant) SetGoal(goal Goal) {
-	ant.goal = goal
-	if goal != nil {
+	if goal != nil && (ant.goal == nil || ant.goal.Id() != goal.Id()) {
 		goal.AddAnt(ant)
 	}
+	ant.goal = goal
 }
 
-func (ant *Ant) Route() Route {
-	return ant.square.goals[ant.goal.Id()]
+func (ant *Ant) Route() *Route {
+	return ant.square.state.Fields[ant.goal.GoalType()].Route(ant.square)
 }
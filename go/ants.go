@@ -1,11 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"os"
-	"bufio"
 	"strconv"
 	"strings"
-	"fmt"
 	"rand"
 )
 
@@ -14,33 +13,57 @@ type Bot interface {
 	DoTurn(s *State) os.Error
 }
 
-var stdin = bufio.NewReader(os.Stdin)
+//EndGameBot is a bot that wants to hear how the game turned out
+type EndGameBot interface {
+	Bot
+	EndGame(s *State, result *GameResult)
+}
 
-//Start takes the initial parameters from stdin
-func (s *State) Start() os.Error {
+//Start takes the initial parameters from the session's engine
+func (s *State) Start(session *Session) os.Error {
+	s.Session = session
+	s.Params = make(map[string]string)
 
 	for {
-		line, err := stdin.ReadString('\n')
+		line, err := session.ReadLine()
+		if err == os.EOF {
+			return s.protocolError(line, "input ended before \"ready\"")
+		}
 		if err != nil {
 			return err
 		}
-		line = line[:len(line)-1] //remove the delimiter
 
-		if line == "" {
+		words := strings.Fields(line)
+		if len(words) == 0 {
 			continue
 		}
 
-		if line == "ready" {
+		if words[0] == "ready" {
 			break
 		}
 
-		words := strings.SplitN(line, " ", 2)
-		if len(words) != 2 {
-			panic(`"` + line + `"`)
-			return os.NewError("invalid command format: " + line)
+		if len(words) < 2 {
+			return s.protocolError(line, "expected a parameter and a value")
 		}
+		s.Params[words[0]] = strings.Join(words[1:], " ")
 
-		param, _ := strconv.Atoi(words[1])
+		if words[0] == "player_seed" {
+			seed, err := strconv.Atoi64(words[1])
+			if err != nil {
+				return s.protocolError(line, "invalid seed")
+			}
+			s.PlayerSeed = seed
+			continue
+		}
+
+		param, err := strconv.Atoi(words[1])
+		if err != nil {
+			// newer engines may send parameters that aren't numbers
+			if !knownParams[words[0]] {
+				continue
+			}
+			return s.protocolError(line, "invalid value")
+		}
 
 		switch words[0] {
 		case "loadtime":
@@ -59,24 +82,40 @@ func (s *State) Start() os.Error {
 			s.AttackRadius2 = param
 		case "spawnradius2":
 			s.SpawnRadius2 = param
-		case "player_seed":
-			param64, _ := strconv.Atoi64(words[1])
-			rand.Seed(param64)
 		case "turn":
+			if param != 0 {
+				return s.protocolError(line, "setup should be turn 0")
+			}
 			s.Turn = param
 
 		default:
-			Log.Panicf("unknown command: %s", line)
+			// newer engines may tell us more than we know what to do with
+			Log.Printf("Protocol: Ignoring unknown parameter: %s", line)
 		}
 	}
 
-	// TODO this init stuff should probably go elsewhere
-	s.CreateSquares()
-	s.Stats = new(Stats)
+	if s.Rows <= 0 || s.Cols <= 0 {
+		return s.protocolError("ready", "map size %vx%v is missing or invalid", s.Rows, s.Cols)
+	}
+
+	s.Init()
 
 	return nil
 }
 
+//Init sets up the map and bookkeeping once the game parameters are known,
+//and forgets any earlier game's goals and items
+func (s *State) Init() {
+	ResetGoals()
+	AllItems = make(ItemSet)
+	s.Random = rand.New(rand.NewSource(s.PlayerSeed))
+	s.CreateSquares()
+	s.Visibility = NewVisibility(s)
+	s.Stats = new(Stats)
+	s.LivingAnts = make(map[int]*Ant)
+	s.Telemetry = NewTelemetry(s.TurnTime)
+}
+
 //Loop handles the majority of communication between your bot and the server.
 //b's DoWork function gets called each turn after the map has been setup
 //BetweenTurnWork gets called after a turn but before the map is reset. It is
@@ -84,30 +123,35 @@ func (s *State) Start() os.Error {
 func (s *State) Loop(b Bot, BetweenTurnWork func()) os.Error {
 
 	//indicate we're ready
-	os.Stdout.Write([]byte("go\n"))
+	s.Session.Go()
 
 	for {
-		line, err := stdin.ReadString('\n')
+		line, err := s.Session.ReadLine()
 		if err != nil {
-			if err == os.EOF {
-				return err
-			}
-			Log.Panicf("ReadString returns an error: %s", err)
 			return err
 		}
-		line = line[:len(line)-1] //remove the delimiter
 
-		if line == "" {
+		words := strings.Fields(line)
+		if len(words) == 0 {
 			continue
 		}
 
-		if line == "go" {
-			// just about to start the turn, clean up unsensed items
+		if words[0] == "go" {
+			// just about to start the turn, see what our ants can see now
+			// and clean up unsensed items
+			s.Budget = NewBudget(s.turnNanos())
+			s.Budget.Begin("update", 0)
+			s.Visibility.Update(s.LivingAnts)
 			AllItems.DestroyUnsensed(s)
 
-			b.DoTurn(s)
+			err = b.DoTurn(s)
+			if err != nil {
+				return err
+			}
 
 			//end turn
+			s.Budget.End()
+			s.Telemetry.EndTurn(s.Turn, s.Budget)
 			s.endTurn()
 
 			BetweenTurnWork()
@@ -115,121 +159,231 @@ func (s *State) Loop(b Bot, BetweenTurnWork func()) os.Error {
 			continue
 		}
 
-		if line == "end" {
+		if words[0] == "end" {
 			break
 		}
 
-		words := strings.SplitN(line, " ", 5)
-		if len(words) < 2 {
-			Log.Panicf("Invalid command format: \"%s\"", line)
-		}
-
 		switch words[0] {
 		case "turn":
-			turn, _ := strconv.Atoi(words[1])
-			if turn != s.Turn+1 {
-				Log.Panicf("Turn number out of sync, expected %v got %v", s.Turn+1, turn)
+			args, err := s.parseArgs(line, words, 1)
+			if err != nil {
+				return err
 			}
-			s.Turn = turn
+			if args[0] != s.Turn+1 {
+				return s.protocolError(line, "turn number out of sync, expected %v", s.Turn+1)
+			}
+			s.Turn = args[0]
+			Log.Turn = s.Turn
+			s.EnemyAnts = s.EnemyAnts[:0]
+			s.DeadAnts = s.DeadAnts[:0]
 
 			s.ResetAntsOnSquares()
 			s.AdvanceAllAnts()
 		case "f":
-			if len(words) < 3 {
-				Log.Panicf("Invalid command format (not enough parameters for food): \"%s\"", line)
+			square, _, err := s.parseSquare(line, words, 2)
+			if err != nil {
+				return err
 			}
 
-			Row, _ := strconv.Atoi(words[1])
-			Col, _ := strconv.Atoi(words[2])
-			square := s.SquareAtRowCol(Row, Col)
 			if square.HasFood() {
 				square.item.Sense()
 			} else {
 				s.NewFood(square)
 			}
 		case "w":
-			if len(words) < 3 {
-				Log.Panicf("Invalid command format (not enough parameters for water): \"%s\"", line)
+			square, _, err := s.parseSquare(line, words, 2)
+			if err != nil {
+				return err
 			}
 
-			Row, _ := strconv.Atoi(words[1])
-			Col, _ := strconv.Atoi(words[2])
-			square := s.SquareAtRowCol(Row, Col)
 			square.Destroy()
 		case "a":
-			if len(words) < 4 {
-				Log.Panicf("Invalid command format (not enough parameters for ant): \"%s\"", line)
-			}
-			Row, _ := strconv.Atoi(words[1])
-			Col, _ := strconv.Atoi(words[2])
-			Owner, _ := strconv.Atoi(words[3])
-			square := s.SquareAtRowCol(Row, Col)
-
-			if Owner == 0 {
-				ant := square.ant
-
-				if ant == nil {
-					if square.HasHill() && square.item.IsMine() {
-						ant = s.NewAnt(square)
-					} else {
-						Log.Panicf("No record of my ant at %v", square)
-					}
+			square, owner, err := s.parseSquare(line, words, 3)
+			if err != nil {
+				return err
+			}
+
+			if owner == 0 && square.ant == nil {
+				if !(square.HasHill() && square.item.IsMine()) {
+					// we've lost track of it somehow; better to adopt it than ignore it
+					Log.Printf("Protocol: No record of my ant at %v", square)
 				}
+				s.NewAnt(square)
 			}
 
-			// TODO track enemy ants
+			if owner != 0 {
+				s.EnemyAnts = append(s.EnemyAnts, &AntSighting{square, owner})
+			}
 
 		case "d":
-			if len(words) < 4 {
-				Log.Panicf("Invalid command format (not enough parameters for dead ant): \"%s\"", line)
-			}
-			Row, _ := strconv.Atoi(words[1])
-			Col, _ := strconv.Atoi(words[2])
-			Owner, _ := strconv.Atoi(words[3])
-			square := s.SquareAtRowCol(Row, Col)
-
-			if Owner == 0 {
-				ant := square.ant
-
-				if ant == nil {
-					if square.HasHill() && square.item.IsMine() {
-						ant = s.NewAnt(square)
-					} else {
-						Log.Panicf("No record of my ant at %v", square)
-					}
-				}
+			square, owner, err := s.parseSquare(line, words, 3)
+			if err != nil {
+				return err
+			}
 
-				ant.Die(s)
+			if owner == 0 {
+				// an ant that spawned and died in the same turn was never ours to track
+				if square.ant != nil {
+					square.ant.Die(s)
+				} else {
+					Log.Printf("Protocol: No record of my dead ant at %v", square)
+				}
 			}
 
-			// TODO track dead enemy ants
+			s.DeadAnts = append(s.DeadAnts, &AntSighting{square, owner})
 
 		case "h":
-			if len(words) < 4 {
-				Log.Panicf("Invalid command format (not enough parameters for hill): \"%s\"", line)
+			square, owner, err := s.parseSquare(line, words, 3)
+			if err != nil {
+				return err
 			}
-			Row, _ := strconv.Atoi(words[1])
-			Col, _ := strconv.Atoi(words[2])
-			Owner, _ := strconv.Atoi(words[3])
-			square := s.SquareAtRowCol(Row, Col)
 
 			if square.HasHill() {
 				square.item.Sense()
 			} else {
-				s.NewHill(Owner, square)
+				s.NewHill(owner, square)
+			}
+
+		default:
+			Log.Printf("Protocol: Ignoring unknown command: %s", line)
+		}
+	}
+
+	return s.endGame(b)
+}
+
+var knownParams = map[string]bool{
+	"loadtime": true, "turntime": true, "rows": true, "cols": true, "turns": true,
+	"viewradius2": true, "attackradius2": true, "spawnradius2": true, "turn": true,
+}
+
+//endGame reads the block after "end": the player count and scores,
+//followed by the final state of the map (which we've no use for) and a
+//last "go". Bots that want the result get it through EndGame.
+func (s *State) endGame(b Bot) os.Error {
+	s.Result = &GameResult{s.Turn, 0, make([]int, 0)}
+
+	for {
+		line, err := s.Session.ReadLine()
+		if err == os.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "go" {
+			break
+		}
+
+		switch words[0] {
+		case "players":
+			args, err := s.parseArgs(line, words, 1)
+			if err != nil {
+				return err
 			}
+			s.Result.Players = args[0]
+		case "score":
+			scores, err := s.parseArgs(line, words, len(words)-1)
+			if err != nil {
+				return err
+			}
+			s.Result.Scores = scores
 		}
 	}
 
+	if s.Result.Players < 1 {
+		return s.protocolError("end", "no player count after \"end\"")
+	}
+	if len(s.Result.Scores) != s.Result.Players {
+		return s.protocolError("end", "got %v scores for %v players", len(s.Result.Scores), s.Result.Players)
+	}
+
+	if endGameBot, ok := b.(EndGameBot); ok {
+		endGameBot.EndGame(s, s.Result)
+	}
+
 	return nil
 }
 
+// A ProtocolError is a line from the engine we couldn't make sense of
+type ProtocolError struct {
+	Line    int // line number in the engine's input, counting from 1
+	Turn    int
+	Text    string
+	Message string
+}
+
+func (err *ProtocolError) String() string {
+	return fmt.Sprintf("protocol error on line %v (turn %v): %v: %q", err.Line, err.Turn, err.Message, err.Text)
+}
+
+func (s *State) protocolError(line string, format string, v ...interface{}) os.Error {
+	return &ProtocolError{s.Session.Line, s.Turn, line, fmt.Sprintf(format, v...)}
+}
+
+// parseArgs converts the first count arguments of a command to ints.
+// Extra arguments are ignored, in case the protocol grows.
+func (s *State) parseArgs(line string, words []string, count int) ([]int, os.Error) {
+	if len(words) < count+1 {
+		return nil, s.protocolError(line, "expected %v arguments to %q", count, words[0])
+	}
+
+	args := make([]int, count)
+	for i := range args {
+		arg, err := strconv.Atoi(words[i+1])
+		if err != nil {
+			return nil, s.protocolError(line, "argument %v is not a number", i+1)
+		}
+		args[i] = arg
+	}
+
+	return args, nil
+}
+
+// parseSquare parses a command whose arguments are a row, a column and
+// (if count is 3) an owner
+func (s *State) parseSquare(line string, words []string, count int) (*Square, int, os.Error) {
+	args, err := s.parseArgs(line, words, count)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	row, col := args[0], args[1]
+	if row < 0 || row >= s.Rows || col < 0 || col >= s.Cols {
+		return nil, 0, s.protocolError(line, "square is off the %vx%v map", s.Rows, s.Cols)
+	}
+
+	owner := 0
+	if count > 2 {
+		owner = args[2]
+		if owner < 0 {
+			return nil, 0, s.protocolError(line, "invalid owner")
+		}
+	}
+
+	return s.SquareAtRowCol(row, col), owner, nil
+}
+
+//turnNanos is how long we allow ourselves per turn
+func (s *State) turnNanos() int64 {
+	if s.Config == nil {
+		return s.TurnTime * 1000000
+	}
+
+	return s.Config.TurnNanos(s)
+}
+
 //Call IssueOrderLoc to issue an order for an ant at loc
 func (s *State) IssueOrderLoc(loc Location, d Direction) {
-	fmt.Fprintf(os.Stdout, "o %d %d %s\n", loc.Row(s), loc.Col(s), d)
+	s.Session.IssueOrder(loc.Row(s), loc.Col(s), d)
 }
 
 //endTurn is called by Loop, you don't need to call it.
 func (s *State) endTurn() {
-	os.Stdout.Write([]byte("go\n"))
+	s.Session.Go()
 }
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+)
+
+// A budget of NoTimeLimit never runs out, e.g. so replays don't depend
+// on timing
+const NoTimeLimit = -1
+
+// By default only look at the clock every this many checks; it isn't
+// free. Phases whose iterations are slow set their own (see CheckEvery).
+const budgetCheckInterval = 16
+
+// A Budget divides one turn's time between the phases of the turn. Each
+// phase gets a deadline when it begins, and loops poll it from their own
+// goroutine, so there's no timer to race with.
+type Budget struct {
+	turnNanos int64 // NoTimeLimit, or how long we allow ourselves this turn
+	start     int64
+	deadline  int64
+	current   *Phase
+	Phases    []*Phase // in the order they ran
+	Nanos     int64    // how long the whole turn took, once it's over
+}
+
+type Phase struct {
+	Name       string
+	start      int64
+	deadline   int64
+	checks     int
+	interval   int   // look at the clock every this many checks, or 0 for budgetCheckInterval
+	Nanos      int64 // how long the phase took, once it's over
+	Iterations int   // loop iterations run by Loop
+	TimedOut   bool
+}
+
+func NewBudget(turnNanos int64) *Budget {
+	now := time.Nanoseconds()
+	deadline := (int64)(math.MaxInt64)
+	if turnNanos != NoTimeLimit {
+		deadline = now + turnNanos
+	}
+
+	return &Budget{turnNanos, now, deadline, nil, make([]*Phase, 0), 0}
+}
+
+// Begin ends the current phase (if any) and starts the next, which may
+// use up to fraction of the turn, or whatever's left of the turn if
+// fraction is 0
+func (budget *Budget) Begin(name string, fraction float64) *Phase {
+	now := time.Nanoseconds()
+	budget.endPhase(now)
+
+	deadline := budget.deadline
+	if fraction > 0 && budget.turnNanos != NoTimeLimit {
+		if slice := now + (int64)(fraction*(float64)(budget.turnNanos)); slice < deadline {
+			deadline = slice
+		}
+	}
+
+	budget.current = &Phase{Name: name, start: now, deadline: deadline}
+	budget.Phases = append(budget.Phases, budget.current)
+	return budget.current
+}
+
+// Phase is the phase that's running now
+func (budget *Budget) Phase() *Phase {
+	return budget.current
+}
+
+func (budget *Budget) endPhase(now int64) {
+	if budget.current != nil {
+		budget.current.Nanos = now - budget.current.start
+		budget.current = nil
+	}
+}
+
+// End finishes the turn and logs where the time went
+func (budget *Budget) End() {
+	now := time.Nanoseconds()
+	budget.endPhase(now)
+	budget.Nanos = now - budget.start
+
+	if Log.Enabled("Timing", LogInfo) {
+		var summary bytes.Buffer
+		for _, phase := range budget.Phases {
+			fmt.Fprintf(&summary, " %v", phase)
+		}
+		Log.Infof("Timing: turn took %.1fms:%v", (float64)(budget.Nanos)/1e6, summary.String())
+	}
+}
+
+func (budget *Budget) Elapsed() int64 {
+	return time.Nanoseconds() - budget.start
+}
+
+// CheckEvery makes Continue look at the clock every n calls, for loops
+// whose iterations are too slow to run several past the deadline
+func (phase *Phase) CheckEvery(n int) *Phase {
+	phase.interval = n
+	return phase
+}
+
+// Continue is false once the phase's time is up. It only looks at the
+// clock every few calls, so it's cheap enough to call per iteration.
+func (phase *Phase) Continue() bool {
+	if phase.TimedOut {
+		return false
+	}
+
+	interval := phase.interval
+	if interval == 0 {
+		interval = budgetCheckInterval
+	}
+
+	phase.checks++
+	if phase.checks%interval != 0 {
+		return true
+	}
+
+	if phase.Expired() {
+		phase.TimedOut = true
+		return false
+	}
+	return true
+}
+
+// Expired looks at the clock right now
+func (phase *Phase) Expired() bool {
+	return time.Nanoseconds() > phase.deadline
+}
+
+// Loop runs body until it returns false or the phase runs out of time
+func (phase *Phase) Loop(body func() bool) {
+	for phase.Continue() && body() {
+		phase.Iterations++
+	}
+}
+
+func (phase *Phase) String() string {
+	timedOut := ""
+	if phase.TimedOut {
+		timedOut = ", timed out"
+	}
+	return fmt.Sprintf("[%v %.1fms, %v iterations%v]", phase.Name, (float64)(phase.Nanos)/1e6, phase.Iterations, timedOut)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestCheckEvery runs loops in phases whose time is already up
+func TestCheckEvery(t *testing.T) {
+	tests := []struct {
+		interval   int
+		iterations int
+	}{
+		{0, budgetCheckInterval - 1},
+		{1, 0},
+		{4, 3},
+	}
+	for _, test := range tests {
+		phase := (&Phase{Name: "test"}).CheckEvery(test.interval)
+		phase.Loop(func() bool {
+			return phase.Iterations < 100
+		})
+		if phase.Iterations != test.iterations || !phase.TimedOut {
+			t.Errorf("checking every %v: %v", test.interval, phase)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Candidate is an ant that can reach a goal, and how far it has to go
+type Candidate struct {
+	ant      *Ant
+	goal     Goal
+	distance int
+	search   *GoalSearch
+	route    *Route
+}
+
+func (candidate *Candidate) String() string {
+	return fmt.Sprintf("[%v is %v steps from %v]", candidate.ant, candidate.distance, candidate.goal)
+}
+
+// Route is only worked out for candidates that actually get assigned
+func (candidate *Candidate) Route() *Route {
+	if candidate.route == nil {
+		candidate.route = candidate.search.RouteFrom(candidate.ant.square)
+	}
+
+	return candidate.route
+}
+
+type CandidateList []*Candidate
+
+func (list CandidateList) Len() int {
+	return len(list)
+}
+
+// highest priority first, then shortest route
+func (list CandidateList) Less(i, j int) bool {
+	pi, pj := list[i].goal.Priority(), list[j].goal.Priority()
+	if pi == pj {
+		return list[i].distance < list[j].distance
+	}
+
+	return pi > pj
+}
+
+func (list CandidateList) Swap(i, j int) {
+	list[i], list[j] = list[j], list[i]
+}
+
+// Assign greedily pairs ants with goals, best candidates first. Each ant
+// and each goal is used at most once; the result is keyed by ant id.
+func (list CandidateList) Assign() map[int]*Candidate {
+	sort.Sort(list)
+
+	assignments := make(map[int]*Candidate)
+	claimed := make(map[GoalId]bool)
+	for _, candidate := range list {
+		_, antTaken := assignments[candidate.ant.id]
+		if antTaken || claimed[candidate.goal.Id()] {
+			continue
+		}
+
+		assignments[candidate.ant.id] = candidate
+		claimed[candidate.goal.Id()] = true
+	}
+
+	return assignments
+}
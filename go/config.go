@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"json"
+	"os"
+)
+
+// Config holds every knob on the bot. Defaults come from DefaultConfig,
+// then a JSON file given with -config, then any other flags. The file
+// uses the field names below as keys, and may leave any of them out:
+//
+//   {
+//     "SearchThreshold": 12,     // how far each goal looks for ants, in steps
+//     "TurnBudget": 0.9,         // fraction of the turn time we let ourselves use
+//     "AnalysisBudget": 0.1,     // ...of which this much for map symmetry,
+//     "SearchBudget": 0.35,      // this much for the goals' own searches,
+//     "FieldBudget": 0.35,       // and this much for the distance fields
+//     "IgnoreTimeBudget": false, // run every search to completion
+//     "EatPriority": 9.9,        // fixed goal priorities...
+//     "ExplorePriority": 8.0,
+//     "RazePriority": 9.5,
+//     "Matrix": "",              // ...unless this names an 8x8 params matrix
+//     "Log": "",                 // log file, directory or "-" for stderr
+//     "LogLevel": "debug",       // off, error, info or debug
+//     "LogTags": "",             // e.g. "BFS,Orders"; empty for all
+//     "Record": "",              // record the game to this file
+//     "Replay": "",              // replay this recording instead of playing
+//     "Telemetry": "",           // save per-turn timings here (.json or .csv)
+//     "Snapshots": "",           // save what we believe each turn in this directory
+//     "CPUProfile": "cpu.prof",  // where `MyBot profile` writes its CPU profile
+//     "MemProfile": "mem.prof",  // ...and its heap profile
+//     "Bot": ""                  // play as this sample bot (see SampleBots)
+//   }
+//
+// The matrix is the one the Ruby bot evolves: a file of 64 bytes, or
+// the same bytes in base64. Each turn, goal priorities are the matrix
+// times the vector of game statistics (see Stats).
+type Config struct {
+	SearchThreshold  int
+	TurnBudget       float64
+	AnalysisBudget   float64
+	SearchBudget     float64
+	FieldBudget      float64
+	IgnoreTimeBudget bool
+
+	EatPriority     float64
+	ExplorePriority float64
+	RazePriority    float64
+	Matrix          string
+
+	Log      string
+	LogLevel string
+	LogTags  string
+
+	Record string
+	Replay string
+
+	Telemetry  string
+	Snapshots  string
+	CPUProfile string
+	MemProfile string
+
+	Bot string
+
+	params *ParamsMatrix
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		SearchThreshold: 12,
+		TurnBudget:      0.9,
+		AnalysisBudget:  0.1,
+		SearchBudget:    0.35,
+		FieldBudget:     0.35,
+		EatPriority:     9.9,
+		ExplorePriority: 8.0,
+		RazePriority:    9.5,
+		LogLevel:        "debug",
+		CPUProfile:      "cpu.prof",
+		MemProfile:      "mem.prof",
+	}
+}
+
+func (config *Config) addFlags(flags *flag.FlagSet) *string {
+	configFile := flags.String("config", "", "JSON file of settings; other flags override it")
+	flags.IntVar(&config.SearchThreshold, "search", config.SearchThreshold, "how far each goal looks for ants, in steps")
+	flags.Float64Var(&config.TurnBudget, "turnbudget", config.TurnBudget, "fraction of the turn time to use at all")
+	flags.Float64Var(&config.AnalysisBudget, "analysisbudget", config.AnalysisBudget, "fraction of the turn time to spend on map symmetry")
+	flags.Float64Var(&config.SearchBudget, "searchbudget", config.SearchBudget, "fraction of the turn time to spend on goal searches")
+	flags.Float64Var(&config.FieldBudget, "fieldbudget", config.FieldBudget, "fraction of the turn time to spend on distance fields")
+	flags.BoolVar(&config.IgnoreTimeBudget, "notimeout", config.IgnoreTimeBudget, "run every search to completion, however long it takes")
+	flags.Float64Var(&config.EatPriority, "eat", config.EatPriority, "priority of eating food")
+	flags.Float64Var(&config.ExplorePriority, "explore", config.ExplorePriority, "priority of exploring")
+	flags.Float64Var(&config.RazePriority, "raze", config.RazePriority, "priority of razing a hill we're sure of")
+	flags.StringVar(&config.Matrix, "matrix", config.Matrix, "8x8 params matrix file, or base64; overrides the fixed priorities")
+	flags.StringVar(&config.Log, "log", config.Log, "log to this file, or to MyBot-<pid>.log in this directory, or - for stderr")
+	flags.StringVar(&config.LogLevel, "loglevel", config.LogLevel, "how much to log with -log: off, error, info or debug")
+	flags.StringVar(&config.LogTags, "logtags", config.LogTags, "comma separated subsystems to log (e.g. BFS,Orders); empty for all")
+	flags.StringVar(&config.Record, "record", config.Record, "record the game to this file")
+	flags.StringVar(&config.Replay, "replay", config.Replay, "replay this recording and check we give the same orders")
+	flags.StringVar(&config.Telemetry, "telemetry", config.Telemetry, "save per-turn timings and counters to this file at game end; .csv for CSV, otherwise JSON")
+	flags.StringVar(&config.Snapshots, "snapshots", config.Snapshots, "save a JSON snapshot of what we believe after every turn in this directory")
+	flags.StringVar(&config.CPUProfile, "cpuprofile", config.CPUProfile, "where `MyBot profile` writes the CPU profile")
+	flags.StringVar(&config.MemProfile, "memprofile", config.MemProfile, "where `MyBot profile` writes the heap profile")
+	flags.StringVar(&config.Bot, "bot", config.Bot, "play as a sample bot instead: greedy, holdhills, hunter, random or turtle")
+	return configFile
+}
+
+// ParseConfig builds the config for a command from its arguments. The
+// flags are parsed twice: once to find -config, and again on top of the
+// file so that flags win. commandFlags, if not nil, adds the command's
+// own flags to each flag set.
+func ParseConfig(name string, args []string, commandFlags func(flags *flag.FlagSet)) (*Config, *flag.FlagSet, os.Error) {
+	config := DefaultConfig()
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	configFile := config.addFlags(flags)
+	if commandFlags != nil {
+		commandFlags(flags)
+	}
+	flags.Parse(args)
+
+	if *configFile != "" {
+		config = DefaultConfig()
+		err := config.load(*configFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		flags = flag.NewFlagSet(name, flag.ExitOnError)
+		config.addFlags(flags)
+		if commandFlags != nil {
+			commandFlags(flags)
+		}
+		flags.Parse(args)
+	}
+
+	if _, ok := SampleBots[config.Bot]; config.Bot != "" && !ok {
+		return nil, nil, os.NewError("unknown sample bot " + config.Bot)
+	}
+
+	if config.Matrix != "" {
+		params, err := LoadParamsMatrix(config.Matrix)
+		if err != nil {
+			return nil, nil, err
+		}
+		config.params = params
+	}
+
+	err := OpenLog(config.Log, config.LogLevel, config.LogTags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return config, flags, nil
+}
+
+func (config *Config) load(filename string) os.Error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(data, config)
+	if err != nil {
+		return os.NewError(fmt.Sprintf("config %v: %v", filename, err))
+	}
+
+	return nil
+}
+
+// TurnNanos is how long we allow ourselves each turn, or NoTimeLimit if
+// we're ignoring the clock
+func (config *Config) TurnNanos(s *State) int64 {
+	if config.IgnoreTimeBudget {
+		return NoTimeLimit
+	}
+
+	return (int64)(config.TurnBudget * (float64)(s.TurnTime*1000000))
+}
+
+// Priority is how much we want goals of goalType this turn
+func (config *Config) Priority(s *State, goalType GoalType) float64 {
+	if config.params != nil {
+		return config.params.Priority(goalType, s.Stats)
+	}
+
+	switch goalType {
+	case EatType:
+		return config.EatPriority
+	case ExploreType:
+		return config.ExplorePriority
+	case RazeType:
+		return config.RazePriority
+	}
+
+	return 0.0
+}
+
+// ParamsMatrix is the Ruby bot's evolved weights: one row per goal, one
+// column per game statistic
+type ParamsMatrix [8][8]float64
+
+// Rows of the matrix, in the Ruby bot's goal order
+var paramsMatrixRows = map[GoalType]int{
+	EatType:     0,
+	RazeType:    1,
+	ExploreType: 4,
+}
+
+// LoadParamsMatrix reads a matrix file, or failing that decodes the
+// argument as base64, like the Ruby bot
+func LoadParamsMatrix(arg string) (*ParamsMatrix, os.Error) {
+	data, err := ioutil.ReadFile(arg)
+	if err != nil {
+		data = make([]byte, base64.StdEncoding.DecodedLen(len(arg)))
+		n, decodeErr := base64.StdEncoding.Decode(data, []byte(arg))
+		if decodeErr != nil {
+			return nil, os.NewError(fmt.Sprintf("matrix %q is neither a file nor base64", arg))
+		}
+		data = data[:n]
+	}
+
+	if len(data) != 64 {
+		return nil, os.NewError(fmt.Sprintf("matrix has %v entries, expected 64", len(data)))
+	}
+
+	params := new(ParamsMatrix)
+	for i, b := range data {
+		params[i/8][i%8] = (float64)(b)
+	}
+
+	return params, nil
+}
+
+func (params *ParamsMatrix) Priority(goalType GoalType, stats *Stats) float64 {
+	row, ok := paramsMatrixRows[goalType]
+	if !ok {
+		return 0.0
+	}
+
+	priority := 0.0
+	for i, stat := range stats.Vector() {
+		priority += params[row][i] * stat
+	}
+
+	return priority
+}
@@ -0,0 +1,194 @@
+package main
+
+// Distance recorded for squares that no target has reached (yet)
+const Unreachable = -1
+
+// A DistanceField is a multi-source BFS shared by every goal of one type.
+// Each square records its route to the nearest target and which goal it
+// leads to. Routes point at the route of the next square along, so the
+// whole field is one forest of shared route nodes. Targets come and go
+// between turns; only the region that depended on a removed target (or
+// square) is recomputed.
+type DistanceField struct {
+	state     *State
+	goalType  GoalType
+	queue     *SearchQueue
+	routes    []*Route
+	goal      []Goal
+	targets   map[GoalId]Goal
+	targetsAt map[Location][]Goal
+}
+
+func NewDistanceField(state *State, goalType GoalType, queue *SearchQueue) *DistanceField {
+	size := state.Rows * state.Cols
+	return &DistanceField{state, goalType, queue, make([]*Route, size), make([]Goal, size), make(map[GoalId]Goal), make(map[Location][]Goal)}
+}
+
+func (field *DistanceField) HasTarget(goal Goal) bool {
+	_, ok := field.targets[goal.Id()]
+	return ok
+}
+
+func (field *DistanceField) AddTarget(goal Goal) {
+	square := goal.Destination()
+	field.targets[goal.Id()] = goal
+	field.targetsAt[square.location] = append(field.targetsAt[square.location], goal)
+
+	// unobserved destinations get seeded by Observe later
+	if square.observed {
+		field.queue.Push(NewSearchNode(goal, NewRoute(square, nil)))
+	}
+}
+
+func (field *DistanceField) RemoveTarget(goal Goal) {
+	if !field.HasTarget(goal) {
+		return
+	}
+
+	square := goal.Destination()
+	field.targets[goal.Id()] = nil, false
+
+	remaining := make([]Goal, 0)
+	for _, other := range field.targetsAt[square.location] {
+		if other.Id() != goal.Id() {
+			remaining = append(remaining, other)
+		}
+	}
+	if len(remaining) == 0 {
+		field.targetsAt[square.location] = nil, false
+	} else {
+		field.targetsAt[square.location] = remaining
+	}
+
+	// everything that was routed to this goal has to find a new target
+	labeled := field.goal[square.location]
+	if labeled != nil && labeled.Id() == goal.Id() {
+		field.invalidate(square)
+	}
+}
+
+// Observe extends the field into a square that just became visible
+func (field *DistanceField) Observe(square *Square) {
+	field.reseed(square)
+}
+
+// Remove drops a square that turned out to be water, along with every
+// route that passed through it
+func (field *DistanceField) Remove(square *Square) {
+	if field.routes[square.location] != nil {
+		field.invalidate(square)
+	}
+}
+
+// Visit settles a node popped from the shared search queue
+func (field *DistanceField) Visit(node *SearchNode) {
+	goal, route := node.goal, node.route
+	square := route.square
+	loc := square.location
+
+	// Purge from queue if the square turned out to be water after it
+	// was queued, the target went away, or the route we came from has
+	// since been replaced
+	if square.IsWater() || !field.HasTarget(goal) {
+		return
+	}
+	if next := route.next; next != nil && field.routes[next.square.location] != next {
+		return
+	}
+
+	// Already have something at least as close
+	current := field.routes[loc]
+	if current != nil && current.Len() <= route.Len() {
+		return
+	}
+
+	field.routes[loc] = route
+	field.goal[loc] = goal
+
+	for _, neighbor := range square.Neighbors() {
+		// Don't search squares we haven't observed yet (they could be
+		// water); Observe picks them up once they're seen
+		if !neighbor.observed {
+			continue
+		}
+
+		neighborRoute := field.routes[neighbor.location]
+		if neighborRoute == nil || neighborRoute.Len() > route.Len()+1 {
+			field.queue.Push(NewSearchNode(goal, NewRoute(neighbor, route)))
+		}
+	}
+}
+
+// Route from square to the nearest target, or nil if nothing is reachable
+func (field *DistanceField) Route(square *Square) *Route {
+	return field.routes[square.location]
+}
+
+func (field *DistanceField) Distance(square *Square) int {
+	route := field.routes[square.location]
+	if route == nil {
+		return Unreachable
+	}
+
+	return route.Len()
+}
+
+// GoalAt is the nearest target reachable from square, or nil
+func (field *DistanceField) GoalAt(square *Square) Goal {
+	goal := field.goal[square.location]
+	if goal == nil || !field.HasTarget(goal) {
+		return nil
+	}
+
+	return goal
+}
+
+// NextStep is the neighbor to move to toward GoalAt(square); nil when
+// square is the destination itself or nothing is reachable
+func (field *DistanceField) NextStep(square *Square) *Square {
+	return field.routes[square.location].NextSquare()
+}
+
+func (field *DistanceField) reset(square *Square) {
+	loc := square.location
+	field.routes[loc] = nil
+	field.goal[loc] = nil
+}
+
+// invalidate clears root and every square whose route runs through it,
+// then re-enqueues the region from its surviving boundary
+func (field *DistanceField) invalidate(root *Square) {
+	invalid := []*Square{root}
+	field.reset(root)
+
+	for i := 0; i < len(invalid); i++ {
+		square := invalid[i]
+		for _, neighbor := range square.Neighbors() {
+			if field.NextStep(neighbor) == square {
+				field.reset(neighbor)
+				invalid = append(invalid, neighbor)
+			}
+		}
+	}
+
+	for _, square := range invalid {
+		field.reseed(square)
+	}
+}
+
+func (field *DistanceField) reseed(square *Square) {
+	if !square.observed || square.IsWater() {
+		return
+	}
+
+	for _, goal := range field.targetsAt[square.location] {
+		field.queue.Push(NewSearchNode(goal, NewRoute(square, nil)))
+	}
+
+	for _, neighbor := range square.Neighbors() {
+		route := field.routes[neighbor.location]
+		if route != nil {
+			field.queue.Push(NewSearchNode(field.goal[neighbor.location], NewRoute(square, route)))
+		}
+	}
+}
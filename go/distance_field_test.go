@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestFieldSkipsWater turns a square into water while the field's node
+// for it is still queued, and checks the field doesn't route through it
+func TestFieldSkipsWater(t *testing.T) {
+	ResetGoals()
+	s := textState(".....", "%%%%%")
+	queue := NewSearchQueue()
+	field := NewDistanceField(s, ExploreType, queue)
+	s.Fields = map[GoalType]*DistanceField{ExploreType: field}
+
+	field.AddTarget(NewExplore(s.SquareAtRowCol(0, 0)))
+	field.Visit(queue.Pop())
+	if queue.Len() != 2 {
+		t.Fatalf("%v nodes queued from the target, want 2", queue.Len())
+	}
+
+	s.SquareAtRowCol(0, 1).Destroy()
+	for queue.Len() > 0 {
+		field.Visit(queue.Pop())
+	}
+
+	for col, distance := range []int{0, Unreachable, 3, 2, 1} {
+		if got := field.Distance(s.SquareAtRowCol(0, col)); got != distance {
+			t.Errorf("distance to (0, %v) is %v, want %v", col, got, distance)
+		}
+	}
+	if route := field.Route(s.SquareAtRowCol(0, 2)); route == nil || route.NextSquare() != s.SquareAtRowCol(0, 3) {
+		t.Errorf("route from (0, 2) is %v, want it to go east", route)
+	}
+}
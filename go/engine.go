@@ -0,0 +1,625 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"exec"
+	"fmt"
+	"io"
+	"os"
+	"rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GameOptions are the engine's settings for one local game
+type GameOptions struct {
+	Turns         int
+	LoadTime      int64 // milliseconds
+	TurnTime      int64 // milliseconds
+	ViewRadius2   int
+	AttackRadius2 int
+	SpawnRadius2  int
+	FoodRate      int   // new food per player every ten turns
+	Seed          int64 // food placement, and every player's player_seed
+}
+
+func DefaultGameOptions() *GameOptions {
+	return &GameOptions{
+		Turns:         1000,
+		LoadTime:      3000,
+		TurnTime:      500,
+		ViewRadius2:   77,
+		AttackRadius2: 5,
+		SpawnRadius2:  1,
+		FoodRate:      5,
+	}
+}
+
+// How long a bot gets to exit once the game is over
+const playerExitNanos = 1e9
+
+// An EnginePlayer is a bot in a local game: a command run with sh,
+// spoken to over its stdin and stdout
+type EnginePlayer struct {
+	Name    string
+	Command string
+	Status  string // survived, eliminated, timeout or crashed
+	Invalid int    // orders ignored because they broke the rules
+
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	lines chan string // closed when the bot closes its stdout
+}
+
+func StartPlayer(name, command string) (*EnginePlayer, os.Error) {
+	cmd := exec.Command("sh", "-c", command)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+
+	player := &EnginePlayer{Name: name, Command: command, Status: "survived", cmd: cmd, stdin: stdin, lines: make(chan string, 256)}
+	go player.read(stdout)
+	return player, nil
+}
+
+func (player *EnginePlayer) read(stdout io.Reader) {
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			player.lines <- strings.TrimRight(line, "\r\n")
+		}
+		if err != nil {
+			close(player.lines)
+			return
+		}
+	}
+}
+
+// Active is whether the bot is still taking turns
+func (player *EnginePlayer) Active() bool {
+	return player.Status == "survived"
+}
+
+func (player *EnginePlayer) send(text string) {
+	if player.stdin == nil {
+		return
+	}
+
+	_, err := io.WriteString(player.stdin, text)
+	if err != nil && player.Active() {
+		player.Status = "crashed"
+	}
+}
+
+// orders reads lines up to the bot's "go", giving up at deadline. Lines
+// left over from a late bot are never read, since a bot that times out
+// doesn't get another turn.
+func (player *EnginePlayer) orders(deadline int64) []string {
+	orders := make([]string, 0)
+	for wait := deadline - time.Nanoseconds(); wait > 0; wait = deadline - time.Nanoseconds() {
+		select {
+		case line, ok := <-player.lines:
+			if !ok {
+				player.Status = "crashed"
+				return orders
+			}
+			if line == "go" {
+				return orders
+			}
+			orders = append(orders, line)
+		case <-time.After(wait):
+		}
+	}
+
+	player.Status = "timeout"
+	return orders
+}
+
+// stop closes the bot's input and waits a little for it to exit before
+// killing it
+func (player *EnginePlayer) stop() {
+	if player.stdin != nil {
+		player.stdin.Close()
+		player.stdin = nil
+	}
+
+	exited := make(chan bool, 1)
+	go func() {
+		player.cmd.Wait()
+		exited <- true
+	}()
+
+	select {
+	case <-exited:
+	case <-time.After(playerExitNanos):
+		player.cmd.Process.Kill()
+		<-exited
+	}
+}
+
+type engineAnt struct {
+	loc   Location
+	owner int
+}
+
+// LocalGame plays one game on a map between subprocess bots, following
+// the official rules closely enough to compare bots: orders (moving onto
+// water or food is not allowed, and ants that end up on the same square
+// all die), then battle (an ant dies if an enemy in range has no more
+// enemies in range than it does), razing, one ant per hill from stored
+// food, gathering food within the spawn radius (food that two players
+// reach is destroyed) and new food. Each hill starts worth 1 point;
+// razing one scores 2 and losing one costs 1. A bot that times out or
+// crashes takes no more turns, but its ants stay on the map.
+type LocalGame struct {
+	options *GameOptions
+	m       *MapFile
+	players []*EnginePlayer
+	random  *rand.Rand
+
+	ants      map[Location]int // owner of the ant on each square
+	food      map[Location]bool
+	hills     map[Location]int // owner of each hill not yet razed
+	hive      []int            // food each player has stored to spawn ants
+	seenWater [][]bool         // water each player has been told about
+	dead      []engineAnt      // ants that died this turn
+	foodDue   int              // tenths of a food owed to the map
+
+	viewOffsets   []*Offset
+	attackOffsets []*Offset
+	spawnOffsets  []*Offset
+
+	Turn   int
+	Scores []int
+}
+
+func NewLocalGame(m *MapFile, players []*EnginePlayer, options *GameOptions) (*LocalGame, os.Error) {
+	if len(players) != m.Players {
+		return nil, os.NewError(fmt.Sprintf("engine: map is for %v players, not %v", m.Players, len(players)))
+	}
+
+	game := &LocalGame{
+		options:       options,
+		m:             m,
+		players:       players,
+		random:        rand.New(rand.NewSource(options.Seed)),
+		ants:          make(map[Location]int),
+		food:          make(map[Location]bool),
+		hills:         make(map[Location]int),
+		hive:          make([]int, m.Players),
+		seenWater:     make([][]bool, m.Players),
+		dead:          make([]engineAnt, 0),
+		viewOffsets:   radiusOffsets(options.ViewRadius2),
+		attackOffsets: radiusOffsets(options.AttackRadius2),
+		spawnOffsets:  radiusOffsets(options.SpawnRadius2),
+		Scores:        make([]int, m.Players),
+	}
+
+	for i := range game.seenWater {
+		game.seenWater[i] = make([]bool, m.Rows*m.Cols)
+	}
+	for loc, owner := range m.Hills {
+		game.hills[loc] = owner
+		game.Scores[owner]++
+	}
+	for loc, owner := range m.Ants {
+		game.ants[loc] = owner
+	}
+	for loc := range m.Food {
+		game.food[loc] = true
+	}
+
+	// maps without starting ants start with one on each hill
+	for player := range players {
+		if game.antCount(player) == 0 {
+			for loc, owner := range game.hills {
+				if owner == player {
+					game.ants[loc] = owner
+				}
+			}
+		}
+	}
+
+	game.spawnFood(2 * m.Players)
+	return game, nil
+}
+
+// radiusOffsets are the offsets within radius2 of a square
+func radiusOffsets(radius2 int) []*Offset {
+	offsets := make([]*Offset, 0)
+	reach := 0
+	for (reach+1)*(reach+1) <= radius2 {
+		reach++
+	}
+	for row := -reach; row <= reach; row++ {
+		for col := -reach; col <= reach; col++ {
+			if row*row+col*col <= radius2 {
+				offsets = append(offsets, &Offset{row, col})
+			}
+		}
+	}
+	return offsets
+}
+
+func (game *LocalGame) offset(loc Location, offset *Offset) Location {
+	row := ((int)(loc)/game.m.Cols + offset.row + game.m.Rows) % game.m.Rows
+	col := ((int)(loc)%game.m.Cols + offset.col + game.m.Cols) % game.m.Cols
+	return game.m.Location(row, col)
+}
+
+func (game *LocalGame) isWater(loc Location) bool {
+	return game.m.Terrain[loc] == Water
+}
+
+func (game *LocalGame) antCount(player int) int {
+	count := 0
+	for _, owner := range game.ants {
+		if owner == player {
+			count++
+		}
+	}
+	return count
+}
+
+func (game *LocalGame) hillCount(player int) int {
+	count := 0
+	for _, owner := range game.hills {
+		if owner == player {
+			count++
+		}
+	}
+	return count
+}
+
+// Play runs the game to the end and stops the bots
+func (game *LocalGame) Play() {
+	for i, player := range game.players {
+		player.send(game.setup(i))
+	}
+	game.collectOrders(game.options.LoadTime)
+
+	for game.Turn = 1; game.Turn <= game.options.Turns; game.Turn++ {
+		for i, player := range game.players {
+			if player.Active() {
+				player.send(game.turnState(i))
+			}
+		}
+		orders := game.collectOrders(game.options.TurnTime)
+
+		game.dead = game.dead[:0]
+		game.move(orders)
+		game.attack()
+		game.raze()
+		game.spawnAnts()
+		game.gather()
+		game.foodDue += game.options.FoodRate * game.m.Players
+		game.spawnFood(game.foodDue / 10)
+		game.foodDue %= 10
+
+		if game.over() {
+			break
+		}
+	}
+	if game.Turn > game.options.Turns {
+		game.Turn = game.options.Turns
+	}
+
+	game.awardBonus()
+	for i, player := range game.players {
+		if player.Status != "crashed" {
+			player.send(game.ending(i))
+		}
+		player.stop()
+	}
+}
+
+func (game *LocalGame) setup(player int) string {
+	options := game.options
+	return fmt.Sprintf("turn 0\nloadtime %v\nturntime %v\nrows %v\ncols %v\nturns %v\nviewradius2 %v\nattackradius2 %v\nspawnradius2 %v\nplayer_seed %v\nready\n",
+		options.LoadTime, options.TurnTime, game.m.Rows, game.m.Cols, options.Turns,
+		options.ViewRadius2, options.AttackRadius2, options.SpawnRadius2, options.Seed+(int64)(player))
+}
+
+// collectOrders gives every active bot until timeMillis from now to
+// finish its turn, waiting for them all at once
+func (game *LocalGame) collectOrders(timeMillis int64) [][]string {
+	deadline := time.Nanoseconds() + timeMillis*1000000
+	orders := make([][]string, len(game.players))
+	var waiting sync.WaitGroup
+	for i, player := range game.players {
+		if player.Active() {
+			waiting.Add(1)
+			go func(i int, player *EnginePlayer) {
+				orders[i] = player.orders(deadline)
+				waiting.Done()
+			}(i, player)
+		}
+	}
+	waiting.Wait()
+	return orders
+}
+
+// relative renumbers owners so that player is 0, as each bot expects
+func (game *LocalGame) relative(owner, player int) int {
+	return (owner - player + game.m.Players) % game.m.Players
+}
+
+func (game *LocalGame) turnState(player int) string {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "turn %v\n", game.Turn)
+
+	visible := game.visible(player)
+	for i, seen := range visible {
+		if !seen {
+			continue
+		}
+
+		loc := (Location)(i)
+		row, col := i/game.m.Cols, i%game.m.Cols
+		if game.isWater(loc) && !game.seenWater[player][i] {
+			game.seenWater[player][i] = true
+			fmt.Fprintf(&buffer, "w %v %v\n", row, col)
+		}
+		if game.food[loc] {
+			fmt.Fprintf(&buffer, "f %v %v\n", row, col)
+		}
+		if owner, ok := game.hills[loc]; ok {
+			fmt.Fprintf(&buffer, "h %v %v %v\n", row, col, game.relative(owner, player))
+		}
+		if owner, ok := game.ants[loc]; ok {
+			fmt.Fprintf(&buffer, "a %v %v %v\n", row, col, game.relative(owner, player))
+		}
+	}
+	for _, ant := range game.dead {
+		if visible[ant.loc] {
+			fmt.Fprintf(&buffer, "d %v %v %v\n", (int)(ant.loc)/game.m.Cols, (int)(ant.loc)%game.m.Cols, game.relative(ant.owner, player))
+		}
+	}
+
+	buffer.WriteString("go\n")
+	return buffer.String()
+}
+
+// visible is every square within view of one of player's ants
+func (game *LocalGame) visible(player int) []bool {
+	visible := make([]bool, game.m.Rows*game.m.Cols)
+	for loc, owner := range game.ants {
+		if owner != player {
+			continue
+		}
+		for _, offset := range game.viewOffsets {
+			visible[game.offset(loc, offset)] = true
+		}
+	}
+	return visible
+}
+
+func (game *LocalGame) ending(player int) string {
+	scores := make([]string, len(game.Scores))
+	for owner, score := range game.Scores {
+		scores[game.relative(owner, player)] = strconv.Itoa(score)
+	}
+	return fmt.Sprintf("end\nplayers %v\nscore %v\ngo\n", game.m.Players, strings.Join(scores, " "))
+}
+
+func (game *LocalGame) move(orders [][]string) {
+	destinations := make(map[Location]Location)
+	for player, lines := range orders {
+		for _, line := range lines {
+			from, to, ok := game.parseOrder(player, line)
+			if !ok {
+				game.players[player].Invalid++
+				continue
+			}
+			if _, moved := destinations[from]; moved {
+				game.players[player].Invalid++
+				continue
+			}
+			destinations[from] = to
+		}
+	}
+
+	arrivals := make(map[Location][]int)
+	for loc, owner := range game.ants {
+		if to, ok := destinations[loc]; ok {
+			loc = to
+		}
+		arrivals[loc] = append(arrivals[loc], owner)
+	}
+
+	game.ants = make(map[Location]int)
+	for loc, owners := range arrivals {
+		if len(owners) == 1 {
+			game.ants[loc] = owners[0]
+			continue
+		}
+		for _, owner := range owners {
+			game.dead = append(game.dead, engineAnt{loc, owner})
+		}
+	}
+}
+
+// parseOrder checks an "o ROW COL DIRECTION" order from player
+func (game *LocalGame) parseOrder(player int, line string) (Location, Location, bool) {
+	words := strings.Fields(line)
+	if len(words) != 4 || words[0] != "o" {
+		return 0, 0, false
+	}
+
+	row, rowErr := strconv.Atoi(words[1])
+	col, colErr := strconv.Atoi(words[2])
+	if rowErr != nil || colErr != nil || row < 0 || row >= game.m.Rows || col < 0 || col >= game.m.Cols {
+		return 0, 0, false
+	}
+
+	from := game.m.Location(row, col)
+	if owner, ok := game.ants[from]; !ok || owner != player {
+		return 0, 0, false
+	}
+
+	var to Location
+	switch words[3] {
+	case "n":
+		to = game.offset(from, Directions[North])
+	case "e":
+		to = game.offset(from, Directions[East])
+	case "s":
+		to = game.offset(from, Directions[South])
+	case "w":
+		to = game.offset(from, Directions[West])
+	default:
+		return 0, 0, false
+	}
+
+	if game.isWater(to) || game.food[to] {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+func (game *LocalGame) attack() {
+	enemies := make(map[Location][]Location)
+	for loc, owner := range game.ants {
+		for _, offset := range game.attackOffsets {
+			target := game.offset(loc, offset)
+			if other, ok := game.ants[target]; ok && other != owner {
+				enemies[loc] = append(enemies[loc], target)
+			}
+		}
+	}
+
+	dying := make([]Location, 0)
+	for loc, attackers := range enemies {
+		for _, enemy := range attackers {
+			if len(enemies[enemy]) <= len(attackers) {
+				dying = append(dying, loc)
+				break
+			}
+		}
+	}
+
+	for _, loc := range dying {
+		game.dead = append(game.dead, engineAnt{loc, game.ants[loc]})
+		game.ants[loc] = 0, false
+	}
+}
+
+func (game *LocalGame) raze() {
+	for loc, owner := range game.hills {
+		if ant, ok := game.ants[loc]; ok && ant != owner {
+			game.Scores[ant] += 2
+			game.Scores[owner]--
+			game.hills[loc] = 0, false
+		}
+	}
+}
+
+func (game *LocalGame) spawnAnts() {
+	locs := make([]int, 0, len(game.hills))
+	for loc := range game.hills {
+		locs = append(locs, (int)(loc))
+	}
+	sort.Ints(locs)
+
+	for _, i := range locs {
+		loc := (Location)(i)
+		owner := game.hills[loc]
+		if _, occupied := game.ants[loc]; !occupied && game.hive[owner] > 0 {
+			game.ants[loc] = owner
+			game.hive[owner]--
+		}
+	}
+}
+
+func (game *LocalGame) gather() {
+	for loc := range game.food {
+		gatherer := -1
+		contested := false
+		for _, offset := range game.spawnOffsets {
+			owner, ok := game.ants[game.offset(loc, offset)]
+			if !ok || owner == gatherer {
+				continue
+			}
+			if gatherer >= 0 {
+				contested = true
+			}
+			gatherer = owner
+		}
+
+		if gatherer < 0 {
+			continue
+		}
+		if !contested {
+			game.hive[gatherer]++
+		}
+		game.food[loc] = false, false
+	}
+}
+
+// spawnFood puts up to count food on empty land at random
+func (game *LocalGame) spawnFood(count int) {
+	size := game.m.Rows * game.m.Cols
+	for tries := 0; count > 0 && tries < 10*count+100; tries++ {
+		loc := (Location)(game.random.Intn(size))
+		_, ant := game.ants[loc]
+		_, hill := game.hills[loc]
+		if game.isWater(loc) || ant || hill || game.food[loc] {
+			continue
+		}
+
+		game.food[loc] = true
+		count--
+	}
+}
+
+// over is true once at most one bot is still playing; bots with
+// neither ants nor hills left are out
+func (game *LocalGame) over() bool {
+	playing := 0
+	for i, player := range game.players {
+		if player.Active() && game.antCount(i) == 0 && game.hillCount(i) == 0 {
+			player.Status = "eliminated"
+		}
+		if player.Active() {
+			playing++
+		}
+	}
+	return playing <= 1
+}
+
+// awardBonus gives a lone survivor the hills it would have razed
+func (game *LocalGame) awardBonus() {
+	survivor := -1
+	for i, player := range game.players {
+		if player.Active() {
+			if survivor >= 0 {
+				return
+			}
+			survivor = i
+		}
+	}
+	if survivor < 0 {
+		return
+	}
+
+	for _, owner := range game.hills {
+		if owner != survivor {
+			game.Scores[survivor] += 2
+			game.Scores[owner]--
+		}
+	}
+}
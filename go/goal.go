@@ -1,9 +1,6 @@
 package main
 
-import (
-	"fmt"
-	"rand"
-)
+import "fmt"
 
 type GoalType int
 
@@ -11,6 +8,7 @@ const (
 	EatType = iota
 	ExploreType
 	WanderType
+	RazeType
 )
 
 type GoalId int
@@ -18,6 +16,16 @@ type GoalId int
 var nextGoalId GoalId = 0
 var AllGoals map[GoalId]Goal = make(map[GoalId]Goal)
 
+// ResetGoals forgets every goal, so another game can start from scratch
+// in the same process
+func ResetGoals() {
+	nextGoalId = 0
+	AllGoals = make(map[GoalId]Goal)
+	EatIndex = make(map[*Square]map[*Food]*Eat)
+	ExploreIndex = make(map[*Square]*Explore)
+	RazeIndex = make(map[*Square]*Raze)
+}
+
 func (id GoalId) Goal() Goal {
 	return AllGoals[id]
 }
@@ -33,6 +41,21 @@ type Goal interface {
 	Die()
 }
 
+// GoalList sorts goals by priority, highest first
+type GoalList []Goal
+
+func (list GoalList) Len() int {
+	return len(list)
+}
+
+func (list GoalList) Less(i, j int) bool {
+	return list[i].Priority() > list[j].Priority()
+}
+
+func (list GoalList) Swap(i, j int) {
+	list[i], list[j] = list[j], list[i]
+}
+
 type DestinationGoal struct {
 	id          GoalId
 	destination *Square
@@ -42,10 +65,11 @@ type DestinationGoal struct {
 func (state *State) GenerateGoals() {
 	state.GenerateEat()
 	state.GenerateExplore()
+	state.GenerateRaze()
 }
 
 func NewDestinationGoal(destination *Square) *DestinationGoal {
-	// intentionally do not add the goal to the destination square; let MyBot do that
+	// intentionally do not add the goal to a distance field; let MyBot do that
 	goal := &DestinationGoal{nextGoalId, destination, make([]*Ant, 0)}
 	nextGoalId++
 	return goal
@@ -64,32 +88,21 @@ func (goal *DestinationGoal) AddAnt(ant *Ant) {
 }
 
 func (goal *DestinationGoal) Die() {
-	// clear any ants participating in this goal
+	// clear any ants still participating in this goal
 	for _, ant := range goal.ants {
-		ant.goal = nil
+		if ant.goal != nil && ant.goal.Id() == goal.id {
+			ant.goal = nil
+		}
 	}
 
 	// remove from master index
 	AllGoals[goal.id] = nil, false
-
-	// remove routes to the goal from the map
-	goal.RemoveFromSquare(goal.destination)
-}
-
-func (goal *DestinationGoal) RemoveFromSquare(square *Square) {
-	_, ok := square.goals[goal.id]
-	if ok {
-		square.goals[goal.id] = nil, false
-		for _, neighbor := range square.Neighbors() {
-			goal.RemoveFromSquare(neighbor)
-		}
-	}
 }
 
-func PickWanderForAnt(state *State, ant *Ant) []*Square {
+func PickWanderForAnt(state *State, ant *Ant) *Route {
 	valid := ant.square.Neighbors().Minus(ant.square.Blacklist())
 	if len(valid) == 0 {
-		return make(Route, 0)
+		return NewRoute(ant.square, nil)
 	}
 
 	var randomSquare *Square = nil
@@ -97,7 +110,7 @@ func PickWanderForAnt(state *State, ant *Ant) []*Square {
 	for _, neighbor := range valid {
 		// better to wander to a square that's well-connected
 		neighborValid := neighbor.Neighbors().Minus(neighbor.Blacklist())
-		score := rand.Float64() * (float64)(len(neighborValid))
+		score := state.Random.Float64() * (float64)(len(neighborValid))
 
 		// best to wander to a square we've never visited
 		if !neighbor.visited {
@@ -110,9 +123,7 @@ func PickWanderForAnt(state *State, ant *Ant) []*Square {
 		}
 	}
 
-	route := make(Route, 1)
-	route[0] = randomSquare
-	return route
+	return NewRoute(ant.square, NewRoute(randomSquare, nil))
 }
 
 type Eat struct {
@@ -125,11 +136,11 @@ func (eat *Eat) GoalType() GoalType {
 }
 
 func (eat *Eat) IsValid() bool {
-	return eat.food.Exists()
+	return eat.food.Exists() && !eat.destination.IsWater()
 }
 
 func (eat *Eat) Priority() float64 {
-	return 9.9 // TODO
+	return eat.destination.state.Config.Priority(eat.destination.state, EatType)
 }
 
 func (eat *Eat) String() string {
@@ -179,11 +190,14 @@ type Explore struct {
 
 var ExploreIndex = make(map[*Square]*Explore)
 
+// GenerateExplore makes a goal of each frontier square, except those
+// the map's symmetry says only lead to water. A frontier whose goal died
+// that way gets a new one if the prediction changes.
 func (state *State) GenerateExplore() {
-	for _, square := range state.ObservedSquares {
-		if square.IsFrontier() {
-			_, ok := ExploreIndex[square]
-			if !ok {
+	for _, square := range state.ObservedSquares.Squares() {
+		if square.IsFrontier() && !state.Analysis.LeadsNowhere(square) {
+			explore, ok := ExploreIndex[square]
+			if !ok || explore.Id().Goal() == nil {
 				ExploreIndex[square] = NewExplore(square)
 			}
 		}
@@ -207,17 +221,87 @@ func (expore *Explore) GoalType() GoalType {
 }
 
 func (explore *Explore) IsValid() bool {
-	return !explore.destination.visited
+	return !explore.destination.visited && !explore.destination.state.Analysis.LeadsNowhere(explore.destination)
 }
 
 func (explore *Explore) Priority() float64 {
-	return 8.0 // TODO
+	return explore.destination.state.Config.Priority(explore.destination.state, ExploreType)
 }
 
 func (explore *Explore) String() string {
 	return fmt.Sprintf("Explore destination %v", explore.destination)
 }
 
+// Only chase predicted hills we're at least this sure of
+const MinRazeConfidence = 0.6
+
+type Raze struct {
+	*DestinationGoal
+	hill       *Hill // nil if we've only predicted a hill here
+	confidence float64
+}
+
+var RazeIndex = make(map[*Square]*Raze)
+
+func (state *State) GenerateRaze() {
+	for square, item := range AllItems {
+		if item.ItemType() == HillType && item.IsEnemy() {
+			raze, ok := RazeIndex[square]
+			if !ok || raze.hill != item {
+				RazeIndex[square] = NewRaze(square, item.(*Hill), 1.0)
+			}
+		}
+	}
+
+	for _, prediction := range state.Analysis.PredictedHills {
+		if prediction.Confidence < MinRazeConfidence {
+			continue
+		}
+
+		raze, ok := RazeIndex[prediction.Square]
+		if !ok || !raze.IsValid() {
+			RazeIndex[prediction.Square] = NewRaze(prediction.Square, nil, prediction.Confidence)
+		}
+	}
+}
+
+func NewRaze(destination *Square, hill *Hill, confidence float64) *Raze {
+	if destination == nil {
+		panic("destination nil!")
+	}
+
+	raze := &Raze{NewDestinationGoal(destination), hill, confidence}
+
+	AllGoals[raze.Id()] = raze
+
+	return raze
+}
+
+func (raze *Raze) GoalType() GoalType {
+	return RazeType
+}
+
+func (raze *Raze) IsValid() bool {
+	if raze.hill != nil {
+		return raze.hill.Exists()
+	}
+
+	// a predicted hill is settled as soon as we can see the square
+	return !raze.destination.observed && raze.destination.state.Analysis.HillConfidence(raze.destination) >= MinRazeConfidence
+}
+
+func (raze *Raze) Priority() float64 {
+	return raze.destination.state.Config.Priority(raze.destination.state, RazeType) * raze.confidence
+}
+
+func (raze *Raze) String() string {
+	if raze.hill == nil {
+		return fmt.Sprintf("[Raze predicted hill at %v (confidence %.2f)]", raze.destination, raze.confidence)
+	}
+
+	return fmt.Sprintf("[Raze hill at %v]", raze.destination)
+}
+
 /* Goal idea for escort - every ant is constantly drawing a route as
  it goes (all squares visited). When an ant is pursuing a goal, that
  route "activates" and any ants on the route can follow it as a goal
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"math"
+)
+
+const infinity = math.MaxInt32
+
+// A GoalSearch keeps the distance from every square within threshold
+// steps to one goal's destination, LPA*-style: g is the settled distance
+// and rhs the one-step lookahead from the neighbors. When a square is
+// observed or turns out to be water only the squares whose distance
+// actually changes are revisited, so the search survives across turns
+// without ever flooding from scratch.
+type GoalSearch struct {
+	goal      Goal
+	threshold int
+	g         map[Location]int
+	rhs       map[Location]int
+	buckets   [][]*Square
+	minBucket int
+}
+
+func NewGoalSearch(goal Goal, threshold int) *GoalSearch {
+	search := &GoalSearch{goal, threshold, make(map[Location]int), make(map[Location]int), make([][]*Square, threshold+1), 0}
+	search.updateSquare(goal.Destination())
+	return search
+}
+
+func (search *GoalSearch) passable(square *Square) bool {
+	return square.observed && !square.IsWater()
+}
+
+func (search *GoalSearch) distance(table map[Location]int, square *Square) int {
+	distance, ok := table[square.location]
+	if !ok {
+		return infinity
+	}
+
+	return distance
+}
+
+func (search *GoalSearch) set(table map[Location]int, square *Square, distance int) {
+	if distance == infinity {
+		table[square.location] = 0, false
+	} else {
+		table[square.location] = distance
+	}
+}
+
+// updateSquare recomputes the lookahead for square and queues it if it's
+// inconsistent and close enough to matter
+func (search *GoalSearch) updateSquare(square *Square) {
+	rhs := infinity
+	if !search.passable(square) {
+		// water or unobserved; nothing goes through it
+	} else if square == search.goal.Destination() {
+		rhs = 0
+	} else {
+		for _, neighbor := range square.Neighbors() {
+			g := search.distance(search.g, neighbor)
+			if g != infinity && g+1 < rhs {
+				rhs = g + 1
+			}
+		}
+	}
+	search.set(search.rhs, square, rhs)
+
+	g := search.distance(search.g, square)
+	key := Min(g, rhs)
+	if g != rhs && key <= search.threshold {
+		search.buckets[key] = append(search.buckets[key], square)
+		if key < search.minBucket {
+			search.minBucket = key
+		}
+	}
+}
+
+// SquareChanged tells the search that square was observed or destroyed
+func (search *GoalSearch) SquareChanged(square *Square) {
+	if !search.touches(square) {
+		return
+	}
+
+	search.updateSquare(square)
+	for _, neighbor := range square.Neighbors() {
+		search.updateSquare(neighbor)
+	}
+}
+
+// touches is true if square is in or next to the searched region
+func (search *GoalSearch) touches(square *Square) bool {
+	if square == search.goal.Destination() {
+		return true
+	}
+
+	if _, ok := search.rhs[square.location]; ok {
+		return true
+	}
+
+	for _, neighbor := range square.Neighbors() {
+		if _, ok := search.g[neighbor.location]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Compute settles every inconsistent square within threshold
+func (search *GoalSearch) Compute() {
+	for search.minBucket < len(search.buckets) {
+		bucket := search.buckets[search.minBucket]
+		if len(bucket) == 0 {
+			search.minBucket++
+			continue
+		}
+
+		square := bucket[len(bucket)-1]
+		search.buckets[search.minBucket] = bucket[:len(bucket)-1]
+
+		// skip stale entries, the square has been requeued or settled since
+		g, rhs := search.distance(search.g, square), search.distance(search.rhs, square)
+		if g == rhs || Min(g, rhs) != search.minBucket {
+			continue
+		}
+
+		if g > rhs {
+			// got closer
+			search.set(search.g, square, rhs)
+		} else {
+			// got further away; clear it and let the neighbors rebuild it
+			search.set(search.g, square, infinity)
+			search.updateSquare(square)
+		}
+
+		for _, neighbor := range square.Neighbors() {
+			search.updateSquare(neighbor)
+		}
+	}
+}
+
+// Distance from square to the goal, or infinity if it's out of range
+func (search *GoalSearch) Distance(square *Square) int {
+	return search.distance(search.g, square)
+}
+
+// RouteFrom follows the distances downhill from square to the goal
+func (search *GoalSearch) RouteFrom(square *Square) *Route {
+	distance := search.Distance(square)
+	if distance == infinity {
+		return nil
+	}
+
+	path := []*Square{square}
+	for current := square; distance > 0; distance-- {
+		var downhill *Square = nil
+		for _, neighbor := range current.Neighbors() {
+			if search.Distance(neighbor) == distance-1 {
+				downhill = neighbor
+				break
+			}
+		}
+
+		// only happens if Compute hasn't caught up with a change yet
+		if downhill == nil {
+			return nil
+		}
+
+		current = downhill
+		path = append(path, current)
+	}
+
+	var route *Route = nil
+	for i := len(path) - 1; i >= 0; i-- {
+		route = NewRoute(path[i], route)
+	}
+
+	return route
+}
+
+// Candidates are the ants within range of the goal
+func (search *GoalSearch) Candidates(ants map[int]*Ant) []*Candidate {
+	candidates := make([]*Candidate, 0)
+	for _, ant := range ants {
+		distance := search.Distance(ant.square)
+		if distance != infinity {
+			candidates = append(candidates, &Candidate{ant, search.goal, distance, search, nil})
+		}
+	}
+
+	return candidates
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"json"
+	"os"
+	"strings"
+)
+
+// HTMLCommand is `MyBot html [flags] RECORDING [SNAPSHOTS]`: write a
+// single HTML file that replays the game on a canvas, with overlays for
+// where each goal type's distance field leads and where enemy ants could
+// attack next turn, and an inspector for any square or ant clicked on.
+// The turns come from a directory of snapshots if given, or else from
+// replaying the recording with the given flags. Everything the page
+// needs is inside it, so it works offline.
+func HTMLCommand(args []string) os.Error {
+	output := ""
+	config, flags, err := ParseConfig("html", args, func(flags *flag.FlagSet) {
+		flags.StringVar(&output, "o", "replay.html", "write the replay to this file")
+	})
+	if err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		return os.NewError("usage: MyBot html [flags] RECORDING [SNAPSHOTS]")
+	}
+
+	recording, err := LoadRecording(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	source := flags.Arg(flags.NArg() - 1)
+	frames, err := LoadFrames(source, config)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return os.NewError("html: no turns in " + source)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return WriteHTMLReplay(file, frames, recording.Orders)
+}
+
+// htmlGame is the data the page's script draws from
+type htmlGame struct {
+	Frames []*Snapshot
+	Orders [][]string // what we sent each turn, by turn number
+}
+
+func WriteHTMLReplay(w io.Writer, frames []*Snapshot, orders [][]string) os.Error {
+	data, err := json.Marshal(&htmlGame{frames, orders})
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(w)
+	out.WriteString(htmlReplayHead)
+	// JSON can't end the script element early, but "</" in a string could
+	out.WriteString(strings.Replace(string(data), "</", "<\\/", -1))
+	out.WriteString(htmlReplayTail)
+	return out.Flush()
+}
+
+const htmlReplayHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>MyBot replay</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 10px; background: #222; color: #ddd; }
+#controls { margin-bottom: 8px; }
+#controls label { margin-right: 12px; }
+#turn { width: 400px; vertical-align: middle; }
+#main { display: flex; align-items: flex-start; }
+canvas { border: 1px solid #555; cursor: crosshair; }
+#inspector { font-family: monospace; white-space: pre-wrap; margin-left: 12px; min-width: 360px; }
+</style>
+</head>
+<body>
+<div id="controls">
+<button id="prev">&lt;</button>
+<button id="play">play</button>
+<button id="next">&gt;</button>
+<input id="turn" type="range" min="0" value="0">
+<span id="label"></span>
+<br>
+overlays:
+<label><input type="checkbox" id="field-eat" checked> eat</label>
+<label><input type="checkbox" id="field-explore"> explore</label>
+<label><input type="checkbox" id="field-raze" checked> raze</label>
+<label><input type="checkbox" id="danger" checked> danger</label>
+<label><input type="checkbox" id="routes" checked> selected ant's route</label>
+</div>
+<div id="main">
+<canvas id="map"></canvas>
+<div id="inspector">click a square or an ant</div>
+</div>
+<script>
+var game = `
+
+const htmlReplayTail = `;
+
+var frames = game.Frames, current = 0, selected = null, timer = null;
+var goalColours = {eat: "#e0c030", explore: "#30c0d0", raze: "#e04040"};
+var playerColours = ["#40d040", "#e04040", "#d040d0", "#40d0d0", "#e0e040", "#4060e0", "#ff8080", "#ff80ff", "#80ffff", "#ffff80"];
+var terrainColours = {"?": "#111", "%": "#1a3a8a", "#": "#2a4aa0", ".": "#6b5a3a", ",": "#7a6a48"};
+var steps = {n: [-1, 0], e: [0, 1], s: [1, 0], w: [0, -1]};
+
+var canvas = document.getElementById("map"), ctx = canvas.getContext("2d");
+var slider = document.getElementById("turn"), label = document.getElementById("label");
+var inspector = document.getElementById("inspector");
+var cell = Math.max(4, Math.min(16, Math.floor(900 / frames[0].Cols)));
+canvas.width = frames[0].Cols * cell;
+canvas.height = frames[0].Rows * cell;
+slider.max = frames.length - 1;
+
+function list(value) { return value || []; }
+function checked(id) { return document.getElementById(id).checked; }
+function wrap(value, size) { return ((value % size) + size) % size; }
+function place(row, col) { return row + "," + col; }
+
+function fillSquare(row, col, colour) {
+  ctx.fillStyle = colour;
+  ctx.fillRect(col * cell, row * cell, cell, cell);
+}
+
+function dot(row, col, radius, colour) {
+  ctx.fillStyle = colour;
+  ctx.beginPath();
+  ctx.arc(col * cell + cell / 2, row * cell + cell / 2, radius, 0, 2 * Math.PI);
+  ctx.fill();
+}
+
+// squares an enemy ant could attack after its next move
+function dangerZone(frame) {
+  var zone = {}, radius2 = frame.AttackRadius2, reach = Math.floor(Math.sqrt(radius2));
+  list(frame.EnemyAnts).forEach(function (enemy) {
+    [[0, 0], [-1, 0], [1, 0], [0, -1], [0, 1]].forEach(function (move) {
+      for (var dr = -reach; dr <= reach; dr++) {
+        for (var dc = -reach; dc <= reach; dc++) {
+          if (dr * dr + dc * dc <= radius2) {
+            zone[wrap(enemy.Row + move[0] + dr, frame.Rows) * frame.Cols + wrap(enemy.Col + move[1] + dc, frame.Cols)] = true;
+          }
+        }
+      }
+    });
+  });
+  return zone;
+}
+
+function goalsById(frame) {
+  var goals = {};
+  frame.Goals.forEach(function (goal) { goals[goal.Id] = goal; });
+  return goals;
+}
+
+function selectedAnt(frame) {
+  if (!selected || selected.ant === undefined) {
+    return null;
+  }
+  return frame.Ants.filter(function (ant) { return ant.Id === selected.ant; })[0] || null;
+}
+
+function draw() {
+  var frame = frames[current], goals = goalsById(frame);
+  slider.value = current;
+  label.textContent = "turn " + frame.Turn + " of " + frame.Turns + ": " + frame.Ants.length + " ants, " +
+    list(frame.EnemyAnts).length + " enemy ants in view, " + frame.Goals.length + " goals";
+
+  frame.Terrain.forEach(function (line, row) {
+    for (var col = 0; col < line.length; col++) {
+      fillSquare(row, col, terrainColours[line[col]] || "#f0f");
+    }
+  });
+
+  if (checked("danger")) {
+    var zone = dangerZone(frame);
+    for (var key in zone) {
+      fillSquare(Math.floor(key / frame.Cols), key % frame.Cols, "rgba(255, 0, 0, 0.3)");
+    }
+  }
+
+  // each field as a tick from every square towards its next step
+  list(frame.Fields).forEach(function (field) {
+    if (!checked("field-" + field.Type)) {
+      return;
+    }
+    ctx.strokeStyle = goalColours[field.Type];
+    ctx.lineWidth = Math.max(1, cell / 8);
+    field.Steps.forEach(function (line, row) {
+      for (var col = 0; col < line.length; col++) {
+        var step = steps[line[col]];
+        if (line[col] === "*") {
+          dot(row, col, cell / 5, goalColours[field.Type]);
+        } else if (step) {
+          var x = col * cell + cell / 2, y = row * cell + cell / 2;
+          ctx.beginPath();
+          ctx.moveTo(x, y);
+          ctx.lineTo(x + step[1] * cell * 0.45, y + step[0] * cell * 0.45);
+          ctx.stroke();
+        }
+      }
+    });
+  });
+
+  list(frame.Items).forEach(function (item) {
+    if (item.Type === "food") {
+      dot(item.Row, item.Col, cell / 3, "#fff8c0");
+    } else {
+      ctx.strokeStyle = playerColours[item.Owner % playerColours.length];
+      ctx.lineWidth = Math.max(1, cell / 6);
+      ctx.strokeRect(item.Col * cell + 1, item.Row * cell + 1, cell - 2, cell - 2);
+    }
+  });
+
+  list(frame.EnemyAnts).forEach(function (enemy) {
+    dot(enemy.Row, enemy.Col, cell / 2.5, playerColours[enemy.Owner % playerColours.length]);
+  });
+
+  frame.Ants.forEach(function (ant) {
+    var goal = goals[ant.Goal];
+    dot(ant.Row, ant.Col, cell / 2.5, playerColours[0]);
+    dot(ant.Row, ant.Col, cell / 6, goal ? goalColours[goal.Type] : "#fff");
+  });
+
+  var ant = selectedAnt(frame);
+  if (ant && checked("routes") && list(ant.Route).length > 1) {
+    ctx.strokeStyle = "#fff";
+    ctx.lineWidth = Math.max(1, cell / 5);
+    ctx.beginPath();
+    ant.Route.forEach(function (square, i) {
+      var x = square.Col * cell + cell / 2, y = square.Row * cell + cell / 2;
+      var previous = ant.Route[i - 1];
+      // don't draw across the map where the route wraps around
+      if (i === 0 || Math.abs(square.Row - previous.Row) > 1 || Math.abs(square.Col - previous.Col) > 1) {
+        ctx.moveTo(x, y);
+      } else {
+        ctx.lineTo(x, y);
+      }
+    });
+    ctx.stroke();
+  }
+
+  if (selected && (ant || selected.ant === undefined)) {
+    var row = ant ? ant.Row : selected.row, col = ant ? ant.Col : selected.col;
+    ctx.strokeStyle = "#fff";
+    ctx.lineWidth = 1;
+    ctx.strokeRect(col * cell + 0.5, row * cell + 0.5, cell - 1, cell - 1);
+  }
+
+  inspect(frame, goals, ant);
+}
+
+function describeGoal(goal) {
+  var text = "goal " + goal.Id + ": " + goal.Type + " at " + place(goal.Row, goal.Col) + ", priority " + goal.Priority.toFixed(2);
+  if (goal.Target) {
+    text += ", " + (goal.Type === "eat" ? "food" : "hill") + " at " + place(goal.Target.Row, goal.Target.Col);
+  }
+  if (goal.Type === "raze" && !goal.Target) {
+    text += ", predicted with confidence " + goal.Confidence.toFixed(2);
+  }
+  return text;
+}
+
+function inspect(frame, goals, ant) {
+  if (!selected) {
+    inspector.textContent = "click a square or an ant";
+    return;
+  }
+  if (!ant && selected.ant !== undefined) {
+    inspector.textContent = "ant " + selected.ant + " isn't alive this turn";
+    return;
+  }
+
+  var row = ant ? ant.Row : selected.row, col = ant ? ant.Col : selected.col;
+  var lines = ["square " + place(row, col) + ": " + ({"?": "unknown", "%": "water", "#": "water", ".": "land", ",": "land, visited"})[frame.Terrain[row][col]]];
+
+  list(frame.Items).forEach(function (item) {
+    if (item.Row === row && item.Col === col) {
+      lines.push(item.Type + (item.Type === "hill" ? " of player " + item.Owner : "") + ", last seen on turn " + item.LastSeen);
+    }
+  });
+  list(frame.EnemyAnts).forEach(function (enemy) {
+    if (enemy.Row === row && enemy.Col === col) {
+      lines.push("enemy ant of player " + enemy.Owner);
+    }
+  });
+
+  if (ant) {
+    lines.push("", "ant " + ant.Id);
+    lines.push(goals[ant.Goal] ? describeGoal(goals[ant.Goal]) : "no goal");
+    var route = list(ant.Route);
+    if (route.length > 0) {
+      lines.push("route, " + (route.length - 1) + " steps: " + route.map(function (square) { return place(square.Row, square.Col); }).join(" "));
+    }
+  }
+
+  var here = frame.Goals.filter(function (goal) { return goal.Row === row && goal.Col === col; });
+  if (here.length > 0) {
+    lines.push("", "goals here:");
+    here.forEach(function (goal) { lines.push(describeGoal(goal) + ", ants: " + (goal.Ants.join(" ") || "none")); });
+  }
+
+  var orders = list(list(game.Orders)[frame.Turn]).filter(function (order) { return order.indexOf("o " + row + " " + col + " ") === 0; });
+  if (orders.length > 0) {
+    lines.push("", "orders sent: " + orders.join(", "));
+  }
+
+  inspector.textContent = lines.join("\n");
+}
+
+function show(index) {
+  current = Math.max(0, Math.min(frames.length - 1, index));
+  draw();
+}
+
+function togglePlay() {
+  if (timer) {
+    clearInterval(timer);
+    timer = null;
+  } else {
+    timer = setInterval(function () {
+      if (current === frames.length - 1) {
+        togglePlay();
+      } else {
+        show(current + 1);
+      }
+    }, 200);
+  }
+  document.getElementById("play").textContent = timer ? "pause" : "play";
+}
+
+canvas.addEventListener("click", function (event) {
+  var rect = canvas.getBoundingClientRect();
+  var row = Math.floor((event.clientY - rect.top) / cell), col = Math.floor((event.clientX - rect.left) / cell);
+  var ant = frames[current].Ants.filter(function (ant) { return ant.Row === row && ant.Col === col; })[0];
+  selected = ant ? {ant: ant.Id} : {row: row, col: col};
+  draw();
+});
+slider.addEventListener("input", function () { show(parseInt(slider.value, 10)); });
+document.getElementById("prev").addEventListener("click", function () { show(current - 1); });
+document.getElementById("next").addEventListener("click", function () { show(current + 1); });
+document.getElementById("play").addEventListener("click", togglePlay);
+Array.prototype.forEach.call(document.querySelectorAll("input[type=checkbox]"), function (box) {
+  box.addEventListener("change", draw);
+});
+document.addEventListener("keydown", function (event) {
+  if (event.key === "ArrowLeft") {
+    show(current - 1);
+  } else if (event.key === "ArrowRight") {
+    show(current + 1);
+  } else if (event.key === " ") {
+    event.preventDefault();
+    togglePlay();
+  }
+});
+
+draw();
+</script>
+</body>
+</html>
+`
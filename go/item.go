@@ -19,15 +19,14 @@ type Item interface {
 }
 
 type BaseItem struct {
-	itemType       ItemType
-	state          *State
-	square         *Square
-	lastSeen       int
-	observableFrom *SquareSet
+	itemType ItemType
+	state    *State
+	square   *Square
+	lastSeen int
 }
 
 func (state *State) NewItem(itemType ItemType, square *Square) BaseItem {
-	return BaseItem{itemType, state, square, state.Turn, nil}
+	return BaseItem{itemType, state, square, state.Turn}
 }
 
 func (item *BaseItem) ItemType() ItemType {
@@ -43,17 +42,7 @@ func (item *BaseItem) TimeSinceLastSeen() int {
 }
 
 func (item *BaseItem) ObservableByAnyAnt() bool {
-	if item.observableFrom == nil {
-		item.observableFrom = item.square.VisibleSquares(item.state)
-	}
-
-	for _, square := range *item.observableFrom {
-		if square.ant != nil {
-			return true
-		}
-	}
-
-	return false
+	return item.state.Visibility.IsVisible(item.square)
 }
 
 type ItemSet map[*Square]Item
@@ -70,7 +59,7 @@ func (items ItemSet) DestroyUnsensed(state *State) {
 			if item.Exists() {
 				square.item = nil
 			}
-			Log.Printf("Item %v should be visible, but it's not there; must have disappeared", item)
+			Log.Printf("Items: Item %v should be visible, but it's not there; must have disappeared", item)
 			items[square] = nil, false
 		}
 	}
@@ -1,13 +1,175 @@
 package main
 
-//import "os"
-//import "log"
-//import "syslog"
-//var Log = syslog.NewLogger(syslog.LOG_DEBUG, 0)
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
 
-type DummyLogger int
-var Log DummyLogger = 42
-func (_ DummyLogger) Printf(format string, v ...interface{}) {
+type LogLevel int
+
+const (
+	LogOff LogLevel = iota
+	LogError
+	LogInfo
+	LogDebug
+)
+
+var LogLevelNames = map[string]LogLevel{
+	"off":   LogOff,
+	"error": LogError,
+	"info":  LogInfo,
+	"debug": LogDebug,
+}
+
+// Logger writes lines like
+//
+//   [12] [1316812345.123] [+004] BFS: Search queue has size 40
+//
+// (turn, time, milliseconds since the previous line, message). Messages
+// name their subsystem by starting with "Tag: ", and the logger can be
+// limited to some tags. When a level or tag is off, calls for it return
+// without formatting anything, but their arguments have still been
+// evaluated and boxed up for the call, so per-node or per-ant logging
+// should check Enabled first.
+type Logger struct {
+	level LogLevel
+	tags  map[string]bool // nil logs every tag
+	out   io.Writer
+	file  *os.File
+	last  int64
+	Turn  int
+}
+
+// Logging is off unless a flag turns it on
+var Log = &Logger{level: LogOff}
+
+func NewLogger(out io.Writer, level LogLevel, tags []string) *Logger {
+	log := &Logger{level: level, out: out, last: time.Nanoseconds()}
+	if len(tags) > 0 {
+		log.tags = make(map[string]bool)
+		for _, tag := range tags {
+			log.tags[tag] = true
+		}
+	}
+
+	return log
+}
+
+// Enabled is whether messages tagged tag would be logged at level, for
+// guarding logging that's expensive to prepare or runs very often
+func (log *Logger) Enabled(tag string, level LogLevel) bool {
+	return level <= log.level && (log.tags == nil || log.tags[tag])
+}
+
+// Printf logs diagnostics at debug level
+func (log *Logger) Printf(format string, v ...interface{}) {
+	if log.level < LogDebug {
+		return
+	}
+	log.write(format, v)
+}
+
+func (log *Logger) Infof(format string, v ...interface{}) {
+	if log.level < LogInfo {
+		return
+	}
+	log.write(format, v)
+}
+
+func (log *Logger) Errorf(format string, v ...interface{}) {
+	if log.level < LogError {
+		return
+	}
+	log.write(format, v)
+}
+
+// Panicf logs (if it can) and then panics, whether or not logging is on.
+// A panic is always worth knowing about, so it ignores the tag filter.
+func (log *Logger) Panicf(format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	if log.level >= LogError {
+		log.writeLine("%s", []interface{}{message})
+	}
+	panic(message)
 }
-func (_ DummyLogger) Panicf(format string, v ...interface{}) {
+
+// write logs a message if its tag is one we're logging
+func (log *Logger) write(format string, v []interface{}) {
+	if log.tags != nil && !log.tags[logTag(format)] {
+		return
+	}
+	log.writeLine(format, v)
+}
+
+func (log *Logger) writeLine(format string, v []interface{}) {
+	now := time.Nanoseconds()
+	var line bytes.Buffer
+	fmt.Fprintf(&line, "[%d] [%.3f] [+%03d] ", log.Turn, (float64)(now)/1e9, (now-log.last)/1e6)
+	fmt.Fprintf(&line, format, v...)
+	line.WriteByte('\n')
+	log.last = now
+
+	// one write per line, so lines survive a crash whole
+	log.out.Write(line.Bytes())
+}
+
+// logTag is the "Tag" of a message starting "Tag: ", or "" if it has none
+func logTag(format string) string {
+	i := strings.Index(format, ": ")
+	if i < 0 || strings.Contains(format[:i], " ") {
+		return ""
+	}
+
+	return format[:i]
+}
+
+func (log *Logger) Close() os.Error {
+	if log.file == nil {
+		return nil
+	}
+
+	return log.file.Close()
+}
+
+// OpenLog replaces Log with one writing to file (a file name, a
+// directory to put MyBot-<pid>.log in, or "-" for stderr). Logging stays
+// off if file is empty.
+func OpenLog(file, levelName, tagList string) os.Error {
+	if file == "" {
+		return nil
+	}
+
+	level, ok := LogLevelNames[levelName]
+	if !ok {
+		return os.NewError("unknown log level " + levelName)
+	}
+
+	tags := make([]string, 0)
+	if tagList != "" {
+		tags = strings.Split(tagList, ",")
+	}
+
+	if file == "-" {
+		Log = NewLogger(os.Stderr, level, tags)
+		return nil
+	}
+
+	filename := file
+	if info, err := os.Stat(filename); err == nil && info.IsDirectory() {
+		filename = path.Join(filename, fmt.Sprintf("MyBot-%d.log", os.Getpid()))
+	}
+
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	Log = NewLogger(out, level, tags)
+	Log.file = out
+	return nil
 }
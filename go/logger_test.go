@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLoggerTags(t *testing.T) {
+	var out bytes.Buffer
+	log := NewLogger(&out, LogDebug, []string{"BFS"})
+	log.Printf("BFS: kept")
+	log.Printf("Goals: dropped")
+	log.Errorf("untagged, dropped")
+
+	if text := out.String(); !strings.Contains(text, "BFS: kept") || strings.Contains(text, "dropped") {
+		t.Errorf("logged %q", text)
+	}
+}
+
+// Panics are logged even when their tag is filtered out
+func TestLoggerPanicIgnoresTags(t *testing.T) {
+	var out bytes.Buffer
+	log := NewLogger(&out, LogError, []string{"BFS"})
+	func() {
+		defer func() {
+			if e := recover(); e != "Goals: no way home" {
+				t.Errorf("panicked with %v", e)
+			}
+		}()
+		log.Panicf("Goals: no way %v", "home")
+	}()
+
+	if !strings.Contains(out.String(), "Goals: no way home") {
+		t.Errorf("logged %q", out.String())
+	}
+}
+
+func TestLoggerEnabled(t *testing.T) {
+	tests := []struct {
+		log   *Logger
+		tag   string
+		level LogLevel
+		want  bool
+	}{
+		{NewLogger(nil, LogInfo, nil), "BFS", LogInfo, true},
+		{NewLogger(nil, LogInfo, nil), "BFS", LogDebug, false},
+		{NewLogger(nil, LogDebug, []string{"BFS"}), "BFS", LogDebug, true},
+		{NewLogger(nil, LogDebug, []string{"BFS"}), "Orders", LogDebug, false},
+		{NewLogger(nil, LogOff, nil), "BFS", LogError, false},
+	}
+	for _, test := range tests {
+		if got := test.log.Enabled(test.tag, test.level); got != test.want {
+			t.Errorf("level %v, tags %v: Enabled(%q, %v) is %v", test.log.level, test.log.tags, test.tag, test.level, got)
+		}
+	}
+}
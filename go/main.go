@@ -1,21 +1,86 @@
 package main
 
 import (
+	"fmt"
 	"os"
 )
 
-//main initializes the state and starts the processing loop
+// Commands other than playing a game, run as `MyBot <command> [flags]`
+var Commands = map[string]func(args []string) os.Error{
+	"html":       HTMLCommand,
+	"mapgen":     MapGenCommand,
+	"profile":    ProfileCommand,
+	"replay":     ReplayCommand,
+	"telemetry":  TelemetryCommand,
+	"tournament": TournamentCommand,
+	"view":       ViewCommand,
+}
+
+//main runs a command, or plays a game over stdin and stdout if there isn't one
 func main() {
+	command, args := PlayCommand, os.Args[1:]
+	if len(os.Args) > 1 {
+		if named, ok := Commands[os.Args[1]]; ok {
+			command, args = named, os.Args[2:]
+		}
+	}
+
+	err := command(args)
+	Log.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+//PlayCommand is `MyBot [flags]`, what the engine runs (see Config)
+func PlayCommand(args []string) os.Error {
+	config, _, err := ParseConfig("MyBot", args, nil)
+	if err != nil {
+		return err
+	}
+
+	if config.Replay != "" {
+		return Replay(config)
+	}
+	if config.Record != "" {
+		return Record(config)
+	}
+
+	return Play(NewStdioSession(), config)
+}
+
+//Play runs a whole game, talking to the engine over session
+func Play(session *Session, config *Config) os.Error {
+	return PlayAndWatch(session, config, nil)
+}
+
+//PlayAndWatch is Play, calling watch (if not nil) at the end of every turn
+func PlayAndWatch(session *Session, config *Config, watch func(s *State)) os.Error {
 	var s State
-	err := s.Start()
+	err := s.Start(session)
 	if err != nil {
-		Log.Panicf("Start() failed (%s)", err)
+		return err
 	}
-	mb := NewBot(&s)
+	mb := NewConfiguredBot(&s, config)
 	err = s.Loop(mb, func() {
 		//if you want to do other between-turn debugging things, you can do them here
+		if config.Snapshots != "" {
+			if err := s.SaveSnapshot(config.Snapshots); err != nil {
+				Log.Errorf("Snapshot: %v", err)
+			}
+		}
+		if watch != nil {
+			watch(&s)
+		}
 	})
 	if err != nil && err != os.EOF {
-		Log.Panicf("Loop() failed (%s)", err)
+		return err
 	}
+
+	if config.Telemetry != "" {
+		return s.Telemetry.Save(config.Telemetry)
+	}
+
+	return nil
 }
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MapFile is a map in the engine's .map format:
+//
+//   rows 4
+//   cols 6
+//   players 2
+//   m ..%%.a
+//   m .0....
+//   ...
+//
+// where '.' is land, '%' water, '*' food, 'a'-'z' an ant of that player,
+// '0'-'9' a hill of that player and 'A'-'Z' an ant standing on its own
+// hill. We also write (and read back) '?' for terrain we haven't seen.
+type MapFile struct {
+	Rows    int
+	Cols    int
+	Players int
+	Terrain []Terrain        // indexed by Location
+	Hills   map[Location]int // owner of each hill
+	Ants    map[Location]int // owner of each ant
+	Food    map[Location]bool
+}
+
+func NewMapFile(rows, cols, players int) *MapFile {
+	return &MapFile{rows, cols, players, make([]Terrain, rows*cols), make(map[Location]int), make(map[Location]int), make(map[Location]bool)}
+}
+
+func (m *MapFile) Location(row, col int) Location {
+	return (Location)(row*m.Cols + col)
+}
+
+func LoadMap(filename string) (*MapFile, os.Error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadMap(file)
+}
+
+func ReadMap(r io.Reader) (*MapFile, os.Error) {
+	reader := bufio.NewReader(r)
+	rows, cols, players := 0, 0, 0
+	var m *MapFile = nil
+	row := 0
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != os.EOF {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line != "" {
+			words := strings.SplitN(line, " ", 2)
+			if len(words) != 2 {
+				return nil, mapError(lineNumber, "invalid line %q", line)
+			}
+
+			if words[0] == "m" {
+				if m == nil {
+					if rows <= 0 || cols <= 0 || players <= 0 {
+						return nil, mapError(lineNumber, "map rows before rows, cols and players")
+					}
+					m = NewMapFile(rows, cols, players)
+				}
+				if row >= rows {
+					return nil, mapError(lineNumber, "more than %v map rows", rows)
+				}
+				if len(words[1]) != cols {
+					return nil, mapError(lineNumber, "map row has %v columns, expected %v", len(words[1]), cols)
+				}
+
+				for col, symbol := range []byte(words[1]) {
+					if !m.setSymbol(m.Location(row, col), symbol) {
+						return nil, mapError(lineNumber, "invalid symbol %q", symbol)
+					}
+				}
+				row++
+			} else {
+				param, convErr := strconv.Atoi(words[1])
+				if convErr != nil {
+					return nil, mapError(lineNumber, "invalid value %q for %v", words[1], words[0])
+				}
+
+				switch words[0] {
+				case "rows":
+					rows = param
+				case "cols":
+					cols = param
+				case "players":
+					players = param
+				default:
+					// other keys carry nothing we need
+				}
+			}
+		}
+
+		if err == os.EOF {
+			break
+		}
+	}
+
+	if m == nil || row != rows {
+		return nil, os.NewError(fmt.Sprintf("map: expected %v map rows, got %v", rows, row))
+	}
+
+	return m, nil
+}
+
+func mapError(lineNumber int, format string, v ...interface{}) os.Error {
+	return os.NewError(fmt.Sprintf("map: line %v: ", lineNumber) + fmt.Sprintf(format, v...))
+}
+
+func (m *MapFile) setSymbol(loc Location, symbol byte) bool {
+	m.Terrain[loc] = Land
+
+	switch {
+	case symbol == '.':
+	case symbol == '%':
+		m.Terrain[loc] = Water
+	case symbol == '?':
+		m.Terrain[loc] = Unknown
+	case symbol == '*':
+		m.Food[loc] = true
+	case symbol >= 'a' && symbol <= 'z':
+		m.Ants[loc] = (int)(symbol - 'a')
+	case symbol >= '0' && symbol <= '9':
+		m.Hills[loc] = (int)(symbol - '0')
+	case symbol >= 'A' && symbol <= 'Z':
+		m.Ants[loc] = (int)(symbol - 'A')
+		m.Hills[loc] = (int)(symbol - 'A')
+	default:
+		return false
+	}
+
+	if owner, ok := m.Ants[loc]; ok && owner >= m.Players {
+		return false
+	}
+	if owner, ok := m.Hills[loc]; ok && owner >= m.Players {
+		return false
+	}
+
+	return true
+}
+
+func (m *MapFile) symbol(loc Location) byte {
+	hill, isHill := m.Hills[loc]
+	ant, isAnt := m.Ants[loc]
+
+	switch {
+	case isHill && isAnt && hill == ant:
+		return 'A' + (byte)(ant)
+	case isHill:
+		return '0' + (byte)(hill)
+	case isAnt:
+		return 'a' + (byte)(ant)
+	case m.Food[loc]:
+		return '*'
+	}
+
+	return m.Terrain[loc].String()[0]
+}
+
+func (m *MapFile) Write(w io.Writer) os.Error {
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "rows %v\ncols %v\nplayers %v\n", m.Rows, m.Cols, m.Players)
+	for row := 0; row < m.Rows; row++ {
+		buffer.WriteString("m ")
+		for col := 0; col < m.Cols; col++ {
+			buffer.WriteByte(m.symbol(m.Location(row, col)))
+		}
+		buffer.WriteByte('\n')
+	}
+
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+func (m *MapFile) Save(filename string) os.Error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return m.Write(file)
+}
+
+// NewState sets up a game as player would see it if the whole map were
+// visible: all the terrain is known, and owners are renumbered so that
+// player is 0, the way the engine does it
+func (m *MapFile) NewState(player int) *State {
+	s := &State{
+		LoadTime:      3000,
+		TurnTime:      1000,
+		Rows:          m.Rows,
+		Cols:          m.Cols,
+		Turns:         1000,
+		ViewRadius2:   77,
+		AttackRadius2: 5,
+		SpawnRadius2:  1,
+	}
+	s.Init()
+
+	for i := range s.Grid {
+		square := &s.Grid[i]
+		switch m.Terrain[i] {
+		case Land:
+			square.Observe(s)
+		case Water:
+			// like water reported by the engine, this is known but not observed
+			square.terrain = Water
+		}
+	}
+
+	for loc, owner := range m.Hills {
+		s.NewHill(m.relativeOwner(owner, player), s.SquareAtLocation(loc))
+	}
+	for loc := range m.Food {
+		s.NewFood(s.SquareAtLocation(loc))
+	}
+	for loc, owner := range m.Ants {
+		// TODO track enemy ants
+		if owner == player {
+			s.NewAnt(s.SquareAtLocation(loc))
+		}
+	}
+
+	return s
+}
+
+func (m *MapFile) relativeOwner(owner, player int) int {
+	return (owner - player + m.Players) % m.Players
+}
+
+// BeliefMap is the map as we currently believe it to be, with anything
+// we haven't seen left unknown
+func (state *State) BeliefMap() *MapFile {
+	players := 1
+	for _, item := range AllItems {
+		if item.ItemType() == HillType && item.(*Hill).owner >= players {
+			players = item.(*Hill).owner + 1
+		}
+	}
+
+	m := NewMapFile(state.Rows, state.Cols, players)
+	for i := range state.Grid {
+		m.Terrain[i] = state.Grid[i].terrain
+	}
+
+	for square, item := range AllItems {
+		switch item.ItemType() {
+		case FoodType:
+			m.Food[square.location] = true
+		case HillType:
+			m.Hills[square.location] = item.(*Hill).owner
+		}
+	}
+	for _, ant := range state.LivingAnts {
+		m.Ants[ant.square.location] = 0
+	}
+
+	return m
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestMapRoundTrip reads each map in maps/, writes it out and reads that
+// back, which should give the same map and the same text
+func TestMapRoundTrip(t *testing.T) {
+	filenames, err := filepath.Glob("maps/*.map")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(filenames) == 0 {
+		t.Fatalf("no maps in maps/")
+	}
+
+	for _, filename := range filenames {
+		text, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("%v: %v", filename, err)
+		}
+		m, err := ReadMap(bytes.NewBuffer(text))
+		if err != nil {
+			t.Fatalf("%v: ReadMap: %v", filename, err)
+		}
+
+		var written bytes.Buffer
+		if err := m.Write(&written); err != nil {
+			t.Fatalf("%v: Write: %v", filename, err)
+		}
+		if !bytes.Equal(written.Bytes(), text) {
+			t.Errorf("%v: written as\n%s", filename, written.Bytes())
+		}
+
+		again, err := ReadMap(&written)
+		if err != nil {
+			t.Fatalf("%v: ReadMap of what we wrote: %v", filename, err)
+		}
+		if !reflect.DeepEqual(again, m) {
+			t.Errorf("%v: reads back as a different map", filename)
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"rand"
+)
+
+// Generates maps in the styles of the official map families, so we can
+// evaluate and evolve on maps nobody has tuned against. Maps are built
+// from one tile per player, repeated across the torus, so every player
+// sees the same map from their own hills (a translational symmetry).
+
+type MapStyle int
+
+const (
+	MazeStyle MapStyle = iota
+	MultiHillMazeStyle
+	RandomWalkStyle
+)
+
+var MapStyleNames = map[string]MapStyle{
+	"maze":            MazeStyle,
+	"multi_hill_maze": MultiHillMazeStyle,
+	"random_walk":     RandomWalkStyle,
+}
+
+func (style MapStyle) String() string {
+	for name, other := range MapStyleNames {
+		if other == style {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+type MapGenOptions struct {
+	Style       MapStyle
+	Rows        int
+	Cols        int
+	Players     int
+	Hills       int     // per player; 0 for the style's default
+	LandDensity float64 // fraction of the map that's land; 0 for the style's default
+	Seed        int64
+}
+
+// Hills must be at least this far apart (squared)
+const MinHillDistance2 = 100
+
+// Give up on a map after this many tries at a connected one
+const MapGenAttempts = 100
+
+type mapGenerator struct {
+	options     *MapGenOptions
+	random      *rand.Rand
+	tileRows    int
+	tileCols    int
+	tilesAcross int // tiles per row of tiles
+	tile        []Terrain
+}
+
+func GenerateMap(options *MapGenOptions) (*MapFile, os.Error) {
+	if options.Players < 2 || options.Players > 10 {
+		return nil, os.NewError(fmt.Sprintf("mapgen: can't make a map for %v players", options.Players))
+	}
+
+	gen := &mapGenerator{options: options, random: rand.New(rand.NewSource(options.Seed))}
+	if !gen.chooseTiles() {
+		return nil, os.NewError(fmt.Sprintf("mapgen: can't split %vx%v evenly between %v players", options.Rows, options.Cols, options.Players))
+	}
+
+	hills := options.Hills
+	if hills == 0 {
+		hills = 1
+		if options.Style == MultiHillMazeStyle {
+			hills = 3
+		}
+	}
+	density := options.LandDensity
+	if density == 0.0 {
+		density = 0.6
+		if options.Style == RandomWalkStyle {
+			density = 0.5
+		}
+	}
+	if err := checkDensity(density); err != nil {
+		return nil, err
+	}
+
+	// every square is the same distance from its own copies, so if one
+	// is too close they all are
+	if !gen.farFromHills(0, nil) {
+		return nil, os.NewError(fmt.Sprintf("mapgen: %vx%v tiles put every hill too close to the other players' copies of it", gen.tileRows, gen.tileCols))
+	}
+
+	for attempt := 0; attempt < MapGenAttempts; attempt++ {
+		gen.tile = make([]Terrain, gen.tileRows*gen.tileCols)
+		switch options.Style {
+		case MazeStyle, MultiHillMazeStyle:
+			gen.maze(density)
+		case RandomWalkStyle:
+			gen.randomWalk(density)
+		default:
+			return nil, os.NewError(fmt.Sprintf("mapgen: unknown style %v", options.Style))
+		}
+
+		m := gen.tileMap()
+		if gen.placeHills(m, hills) && gen.connect(m) {
+			return m, nil
+		}
+	}
+
+	return nil, os.NewError(fmt.Sprintf("mapgen: no connected %v map after %v attempts", options.Style, MapGenAttempts))
+}
+
+// checkDensity fails unless density is in (0, 1]: any more land than the
+// map has (or NaN) and we'd never finish carving it out
+func checkDensity(density float64) os.Error {
+	if !(density > 0.0 && density <= 1.0) {
+		return os.NewError(fmt.Sprintf("mapgen: land density %v isn't in (0, 1]", density))
+	}
+	return nil
+}
+
+// chooseTiles splits the map into a grid of one tile per player, as
+// close to square as we can
+func (gen *mapGenerator) chooseTiles() bool {
+	options := gen.options
+	found := false
+	for down := 1; down <= options.Players; down++ {
+		across := options.Players / down
+		if down*across != options.Players || options.Rows%down != 0 || options.Cols%across != 0 ||
+			options.Rows/down < 2 || options.Cols/across < 2 {
+			continue
+		}
+
+		rows, cols := options.Rows/down, options.Cols/across
+		if !found || Abs(rows-cols) < Abs(gen.tileRows-gen.tileCols) {
+			gen.tileRows, gen.tileCols, gen.tilesAcross = rows, cols, across
+			found = true
+		}
+	}
+
+	return found
+}
+
+// the tile wraps around on itself, like a little torus
+func (gen *mapGenerator) tileIndex(row, col int) int {
+	row = (row%gen.tileRows + gen.tileRows) % gen.tileRows
+	col = (col%gen.tileCols + gen.tileCols) % gen.tileCols
+	return row*gen.tileCols + col
+}
+
+func (gen *mapGenerator) landCount() int {
+	land := 0
+	for _, terrain := range gen.tile {
+		if terrain == Land {
+			land++
+		}
+	}
+	return land
+}
+
+// maze carves a spanning tree of corridors between cells on even
+// squares, then knocks out walls at random to make loops until the tile
+// is dense enough
+func (gen *mapGenerator) maze(density float64) {
+	for i := range gen.tile {
+		gen.tile[i] = Water
+	}
+
+	cellRows, cellCols := gen.tileRows/2, gen.tileCols/2
+	visited := make([]bool, cellRows*cellCols)
+	stack := []int{gen.random.Intn(len(visited))}
+	visited[stack[0]] = true
+	gen.tile[gen.tileIndex(stack[0]/cellCols*2, stack[0]%cellCols*2)] = Land
+
+	for len(stack) > 0 {
+		cell := stack[len(stack)-1]
+		row, col := cell/cellCols, cell%cellCols
+
+		unvisited := make([]*Offset, 0)
+		for direction := North; direction < NoMovement; direction++ {
+			offset := Directions[direction]
+			next := ((row+offset.row+cellRows)%cellRows)*cellCols + (col+offset.col+cellCols)%cellCols
+			if !visited[next] {
+				unvisited = append(unvisited, offset)
+			}
+		}
+		if len(unvisited) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		offset := unvisited[gen.random.Intn(len(unvisited))]
+		next := ((row+offset.row+cellRows)%cellRows)*cellCols + (col+offset.col+cellCols)%cellCols
+		nextRow, nextCol := next/cellCols, next%cellCols
+
+		// dig from both ends; they only differ when an odd-sized tile
+		// leaves a spare row or column to cross at the wrap
+		gen.tile[gen.tileIndex(row*2+offset.row, col*2+offset.col)] = Land
+		gen.tile[gen.tileIndex(nextRow*2-offset.row, nextCol*2-offset.col)] = Land
+		gen.tile[gen.tileIndex(nextRow*2, nextCol*2)] = Land
+
+		visited[next] = true
+		stack = append(stack, next)
+	}
+
+	target := (int)(density * (float64)(len(gen.tile)))
+	for land := gen.landCount(); land < target; {
+		i := gen.random.Intn(len(gen.tile))
+		if gen.tile[i] == Water {
+			gen.tile[i] = Land
+			land++
+		}
+	}
+}
+
+// randomWalk wanders a single digger around the tile until enough of
+// it is land, so everything it digs is connected
+func (gen *mapGenerator) randomWalk(density float64) {
+	for i := range gen.tile {
+		gen.tile[i] = Water
+	}
+
+	target := (int)(density * (float64)(len(gen.tile)))
+	row, col := gen.random.Intn(gen.tileRows), gen.random.Intn(gen.tileCols)
+	gen.tile[gen.tileIndex(row, col)] = Land
+	for land := 1; land < target; {
+		offset := Directions[(Direction)(gen.random.Intn((int)(NoMovement)))]
+		row, col = row+offset.row, col+offset.col
+
+		i := gen.tileIndex(row, col)
+		if gen.tile[i] == Water {
+			gen.tile[i] = Land
+			land++
+		}
+	}
+}
+
+// tileMap lays a copy of the tile down for every player
+func (gen *mapGenerator) tileMap() *MapFile {
+	options := gen.options
+	m := NewMapFile(options.Rows, options.Cols, options.Players)
+	for row := 0; row < m.Rows; row++ {
+		for col := 0; col < m.Cols; col++ {
+			m.Terrain[m.Location(row, col)] = gen.tile[gen.tileIndex(row, col)]
+		}
+	}
+
+	return m
+}
+
+// tileOrigin is the top left corner of player's tile
+func (gen *mapGenerator) tileOrigin(player int) (int, int) {
+	return player / gen.tilesAcross * gen.tileRows, player % gen.tilesAcross * gen.tileCols
+}
+
+// placeHills picks hill squares in the tile and gives each player a
+// copy of them in their own tile
+func (gen *mapGenerator) placeHills(m *MapFile, count int) bool {
+	land := make([]int, 0)
+	for i, terrain := range gen.tile {
+		if terrain == Land {
+			land = append(land, i)
+		}
+	}
+
+	placed := make([]int, 0)
+	for _, i := range gen.random.Perm(len(land)) {
+		if len(placed) == count {
+			break
+		}
+
+		candidate := land[i]
+		if gen.farFromHills(candidate, placed) {
+			placed = append(placed, candidate)
+		}
+	}
+	if len(placed) < count {
+		return false
+	}
+
+	for player := 0; player < m.Players; player++ {
+		rowOrigin, colOrigin := gen.tileOrigin(player)
+		for _, i := range placed {
+			m.Hills[m.Location(rowOrigin+i/gen.tileCols, colOrigin+i%gen.tileCols)] = player
+		}
+	}
+
+	return true
+}
+
+// farFromHills checks candidate against the placed hills in every
+// player's copy of the tile, and against its own copies in the other
+// players' tiles
+func (gen *mapGenerator) farFromHills(candidate int, placed []int) bool {
+	for player := 0; player < gen.options.Players; player++ {
+		if player > 0 && gen.tileDistance2(candidate, candidate, player) < MinHillDistance2 {
+			return false
+		}
+		for _, i := range placed {
+			if gen.tileDistance2(candidate, i, player) < MinHillDistance2 {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// tileDistance2 is the squared distance across the map from square a of
+// the first player's tile to square b of player's tile
+func (gen *mapGenerator) tileDistance2(a, b, player int) int {
+	options := gen.options
+	rowOrigin, colOrigin := gen.tileOrigin(player)
+	rdelt := Abs(a/gen.tileCols - (rowOrigin + b/gen.tileCols))
+	cdelt := Abs(a%gen.tileCols - (colOrigin + b%gen.tileCols))
+	dr, dc := Min(rdelt, options.Rows-rdelt), Min(cdelt, options.Cols-cdelt)
+	return dr*dr + dc*dc
+}
+
+// connect checks that every hill can reach every other, and floods any
+// land that can't be reached from the hills so nobody spawns food there
+func (gen *mapGenerator) connect(m *MapFile) bool {
+	var start Location
+	for loc := range m.Hills {
+		start = loc
+		break
+	}
+
+	reached := make([]bool, len(m.Terrain))
+	reached[start] = true
+	queue := []Location{start}
+	for i := 0; i < len(queue); i++ {
+		row, col := (int)(queue[i])/m.Cols, (int)(queue[i])%m.Cols
+		for direction := North; direction < NoMovement; direction++ {
+			offset := Directions[direction]
+			next := m.Location((row+offset.row+m.Rows)%m.Rows, (col+offset.col+m.Cols)%m.Cols)
+			if !reached[next] && m.Terrain[next] == Land {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	for loc := range m.Hills {
+		if !reached[loc] {
+			return false
+		}
+	}
+
+	for i := range m.Terrain {
+		if !reached[i] {
+			m.Terrain[i] = Water
+		}
+	}
+
+	return true
+}
+
+// MapGenCommand is `MyBot mapgen [flags]`
+func MapGenCommand(args []string) os.Error {
+	flags := flag.NewFlagSet("mapgen", flag.ExitOnError)
+	style := flags.String("style", "random_walk", "map family: maze, multi_hill_maze or random_walk")
+	rows := flags.Int("rows", 60, "number of rows")
+	cols := flags.Int("cols", 60, "number of columns")
+	players := flags.Int("players", 2, "number of players (2-10)")
+	hills := flags.Int("hills", 0, "hills per player (0 for the style's default)")
+	density := flags.Float64("density", 0.0, "fraction of the map that's land, in (0, 1] (unset for the style's default)")
+	seed := flags.Int64("seed", 1, "random seed for the first map")
+	count := flags.Int("count", 1, "number of maps to generate, with consecutive seeds")
+	dir := flags.String("dir", ".", "directory to write maps into")
+	flags.Parse(args)
+
+	mapStyle, ok := MapStyleNames[*style]
+	if !ok {
+		return os.NewError("mapgen: unknown style " + *style)
+	}
+	// 0 means the style's default in the options, but not on the command line
+	var err os.Error
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "density" {
+			err = checkDensity(*density)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < *count; i++ {
+		options := &MapGenOptions{mapStyle, *rows, *cols, *players, *hills, *density, *seed + (int64)(i)}
+		m, err := GenerateMap(options)
+		if err != nil {
+			return err
+		}
+
+		filename := path.Join(*dir, fmt.Sprintf("%v_%02dp_%02d.map", mapStyle, *players, i+1))
+		err = m.Save(filename)
+		if err != nil {
+			return err
+		}
+		fmt.Println(filename)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGenerateMapRejectsDensity(t *testing.T) {
+	for _, density := range []float64{-0.5, 1.5, math.NaN(), math.Inf(1)} {
+		m, err := GenerateMap(&MapGenOptions{MazeStyle, 40, 40, 2, 0, density, 1})
+		if err == nil {
+			t.Errorf("density %v: generated a map\n%v", density, m)
+		}
+	}
+
+	for _, density := range []float64{0.0, 0.3, 1.0} {
+		if _, err := GenerateMap(&MapGenOptions{RandomWalkStyle, 40, 40, 2, 0, density, 1}); err != nil {
+			t.Errorf("density %v: %v", density, err)
+		}
+	}
+}
+
+// With -count 0 the command writes no maps, so it only fails on its flags
+func TestMapGenCommandRejectsDensity(t *testing.T) {
+	for _, density := range []string{"0", "-1", "1.01", "NaN"} {
+		if err := MapGenCommand([]string{"-density", density, "-count", "0"}); err == nil {
+			t.Errorf("-density %v: no error", density)
+		}
+	}
+	if err := MapGenCommand([]string{"-density", "0.5", "-count", "0"}); err != nil {
+		t.Errorf("-density 0.5: %v", err)
+	}
+}
+
+// TestGenerateMapHillDistance checks that no two hills, a player's own
+// or anyone else's, are closer than MinHillDistance2, and that tiles too
+// small to allow that are refused
+func TestGenerateMapHillDistance(t *testing.T) {
+	for _, options := range []*MapGenOptions{
+		&MapGenOptions{MazeStyle, 20, 40, 4, 0, 0.0, 1},
+		&MapGenOptions{MultiHillMazeStyle, 24, 48, 2, 0, 0.0, 2},
+		&MapGenOptions{RandomWalkStyle, 30, 30, 3, 2, 0.0, 3},
+	} {
+		m, err := GenerateMap(options)
+		if err != nil {
+			t.Errorf("%+v: %v", options, err)
+			continue
+		}
+
+		for a := range m.Hills {
+			for b := range m.Hills {
+				rdelt := Abs((int)(a)/m.Cols - (int)(b)/m.Cols)
+				cdelt := Abs((int)(a)%m.Cols - (int)(b)%m.Cols)
+				dr, dc := Min(rdelt, m.Rows-rdelt), Min(cdelt, m.Cols-cdelt)
+				if a != b && dr*dr+dc*dc < MinHillDistance2 {
+					t.Errorf("%+v: hills at %v and %v are too close\n%v", options, a, b, m)
+				}
+			}
+		}
+	}
+
+	// 8x8 tiles put every hill 8 squares from its neighbours' copies
+	if m, err := GenerateMap(&MapGenOptions{MazeStyle, 16, 16, 4, 0, 0.0, 1}); err == nil {
+		t.Errorf("generated a map with 8x8 tiles\n%v", m)
+	}
+}
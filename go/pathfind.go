@@ -0,0 +1,254 @@
+package main
+
+import (
+	"container/heap"
+)
+
+// Single-target path queries. The distance fields flood the whole map for
+// a goal type; these are for goals that only need one route (e.g. hill to
+// hill, ant to escortee) and shouldn't pay for a flood.
+
+// How path queries treat squares we haven't observed yet
+type UnobservedPolicy int
+
+const (
+	AvoidUnobserved    UnobservedPolicy = iota // never path through them
+	AllowUnobserved                            // assume they're land
+	PenalizeUnobserved                         // assume land, but each step costs extra
+)
+
+type PathOptions struct {
+	Unobserved        UnobservedPolicy
+	UnobservedPenalty int // extra cost per unobserved square entered under PenalizeUnobserved
+	MaxExpansions     int // give up after expanding this many squares; 0 for no limit
+}
+
+var DefaultPathOptions = &PathOptions{AvoidUnobserved, 2, 0}
+
+func (options *PathOptions) passable(square *Square) bool {
+	return !square.IsWater() && (square.observed || options.Unobserved != AvoidUnobserved)
+}
+
+// stepCost is the cost of moving onto square
+func (options *PathOptions) stepCost(square *Square) int {
+	if !square.observed && options.Unobserved == PenalizeUnobserved {
+		return 1 + options.UnobservedPenalty
+	}
+
+	return 1
+}
+
+// ManhattanDistance is the number of steps between two squares on the
+// torus ignoring water - an admissible heuristic for A*
+func ManhattanDistance(state *State, a, b *Square) int {
+	rdelt := Abs(a.location.Row(state) - b.location.Row(state))
+	cdelt := Abs(a.location.Col(state) - b.location.Col(state))
+	return Min(rdelt, state.Rows-rdelt) + Min(cdelt, state.Cols-cdelt)
+}
+
+type pathNode struct {
+	route    *Route
+	cost     int
+	priority int
+}
+
+type pathHeap []*pathNode
+
+func (h pathHeap) Len() int {
+	return len(h)
+}
+
+func (h pathHeap) Less(i, j int) bool {
+	if h[i].priority == h[j].priority {
+		// prefer the node closer to the target on ties
+		return h[i].cost > h[j].cost
+	}
+
+	return h[i].priority < h[j].priority
+}
+
+func (h pathHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *pathHeap) Push(x interface{}) {
+	*h = append(*h, x.(*pathNode))
+}
+
+func (h *pathHeap) Pop() interface{} {
+	old := *h
+	node := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return node
+}
+
+// FindPath runs A* and returns the route from `from` to `to`, or nil if
+// there isn't one (or the expansion limit was hit). The search runs
+// backwards from `to` so the routes it builds share tails.
+func FindPath(state *State, from, to *Square, options *PathOptions) *Route {
+	if !options.passable(from) || !options.passable(to) {
+		return nil
+	}
+
+	open := new(pathHeap)
+	best := make(map[Location]int)
+
+	heap.Push(open, &pathNode{NewRoute(to, nil), 0, ManhattanDistance(state, to, from)})
+	best[to.location] = 0
+
+	expansions := 0
+	for open.Len() > 0 {
+		node := heap.Pop(open).(*pathNode)
+		square := node.route.square
+
+		if square == from {
+			return node.route
+		}
+
+		// stale entry, we've found a cheaper way here since it was pushed
+		if node.cost > best[square.location] {
+			continue
+		}
+
+		expansions++
+		if options.MaxExpansions > 0 && expansions > options.MaxExpansions {
+			return nil
+		}
+
+		// moving from neighbor onto square
+		cost := node.cost + options.stepCost(square)
+		for _, neighbor := range square.Neighbors() {
+			if !options.passable(neighbor) {
+				continue
+			}
+
+			previous, seen := best[neighbor.location]
+			if seen && previous <= cost {
+				continue
+			}
+
+			best[neighbor.location] = cost
+			heap.Push(open, &pathNode{NewRoute(neighbor, node.route), cost, cost + ManhattanDistance(state, neighbor, from)})
+		}
+	}
+
+	return nil
+}
+
+// FindPathBidirectional grows uniform-cost searches from both ends and
+// stops once they've met and neither frontier can improve the meeting
+// point. It needs no heuristic, so it's the better choice when water
+// makes Manhattan distance a poor guess.
+func FindPathBidirectional(state *State, from, to *Square, options *PathOptions) *Route {
+	if !options.passable(from) || !options.passable(to) {
+		return nil
+	}
+
+	if from == to {
+		return NewRoute(to, nil)
+	}
+
+	// the backward search (from `to`) builds routes directly; the forward
+	// search (from `from`) just remembers where it came from
+	backwardOpen, forwardOpen := new(pathHeap), new(pathHeap)
+	backward := make(map[Location]*pathNode)
+	forwardCost := make(map[Location]int)
+	forwardParent := make(map[Location]*Square)
+
+	backwardStart := &pathNode{NewRoute(to, nil), 0, 0}
+	heap.Push(backwardOpen, backwardStart)
+	backward[to.location] = backwardStart
+
+	heap.Push(forwardOpen, &pathNode{NewRoute(from, nil), 0, 0})
+	forwardCost[from.location] = 0
+
+	var meeting *Square = nil
+	meetingCost := 0
+
+	// only squares we actually expand count against the limit, not the
+	// stale entries left behind when a cheaper way to a square turned up
+	expansions := 0
+	overLimit := func() bool {
+		expansions++
+		return options.MaxExpansions > 0 && expansions > options.MaxExpansions
+	}
+
+	for backwardOpen.Len() > 0 && forwardOpen.Len() > 0 {
+		if meeting != nil && (*backwardOpen)[0].cost+(*forwardOpen)[0].cost >= meetingCost {
+			break
+		}
+
+		if backwardOpen.Len() <= forwardOpen.Len() {
+			node := heap.Pop(backwardOpen).(*pathNode)
+			square := node.route.square
+			if node != backward[square.location] {
+				continue
+			}
+			if overLimit() {
+				return nil
+			}
+
+			cost := node.cost + options.stepCost(square)
+			for _, neighbor := range square.Neighbors() {
+				if !options.passable(neighbor) {
+					continue
+				}
+
+				previous, seen := backward[neighbor.location]
+				if seen && previous.cost <= cost {
+					continue
+				}
+
+				next := &pathNode{NewRoute(neighbor, node.route), cost, cost}
+				backward[neighbor.location] = next
+				heap.Push(backwardOpen, next)
+
+				if other, ok := forwardCost[neighbor.location]; ok && (meeting == nil || cost+other < meetingCost) {
+					meeting, meetingCost = neighbor, cost+other
+				}
+			}
+		} else {
+			node := heap.Pop(forwardOpen).(*pathNode)
+			square := node.route.square
+			if node.cost > forwardCost[square.location] {
+				continue
+			}
+			if overLimit() {
+				return nil
+			}
+
+			for _, neighbor := range square.Neighbors() {
+				if !options.passable(neighbor) {
+					continue
+				}
+
+				cost := node.cost + options.stepCost(neighbor)
+				previous, seen := forwardCost[neighbor.location]
+				if seen && previous <= cost {
+					continue
+				}
+
+				forwardCost[neighbor.location] = cost
+				forwardParent[neighbor.location] = square
+				heap.Push(forwardOpen, &pathNode{NewRoute(neighbor, nil), cost, cost})
+
+				if other, ok := backward[neighbor.location]; ok && (meeting == nil || cost+other.cost < meetingCost) {
+					meeting, meetingCost = neighbor, cost+other.cost
+				}
+			}
+		}
+	}
+
+	if meeting == nil {
+		return nil
+	}
+
+	// walk the forward half back to `from`, prepending onto the backward half
+	route := backward[meeting.location].route
+	for square := meeting; square != from; {
+		square = forwardParent[square.location]
+		route = NewRoute(square, route)
+	}
+
+	return route
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"rand"
+	"testing"
+)
+
+// textState is the map drawn in lines: '%' for water, '?' for land we
+// haven't observed and anything else for observed land
+func textState(lines ...string) *State {
+	s := randomState(len(lines), len(lines[0]), 0.0, 0)
+	for row, line := range lines {
+		for col, symbol := range []byte(line) {
+			switch symbol {
+			case '%':
+				s.SquareAtRowCol(row, col).Destroy()
+			case '?':
+				s.SquareAtRowCol(row, col).observed = false
+			}
+		}
+	}
+	return s
+}
+
+// bfsSteps is the number of steps between two squares by plain BFS over
+// observed land, or -1 if there's no way
+func bfsSteps(s *State, from, to *Square) int {
+	steps := map[*Square]int{from: 0}
+	queue := []*Square{from}
+	for len(queue) > 0 {
+		square := queue[0]
+		queue = queue[1:]
+		if square == to {
+			return steps[square]
+		}
+		for _, neighbor := range square.Neighbors() {
+			if _, ok := steps[neighbor]; !ok && neighbor.observed {
+				steps[neighbor] = steps[square] + 1
+				queue = append(queue, neighbor)
+			}
+		}
+	}
+	return -1
+}
+
+// checkPath fails unless route is a walk of adjacent land squares from
+// from to to, steps long
+func checkPath(t *testing.T, name string, route *Route, from, to *Square, steps int) {
+	if route == nil {
+		t.Fatalf("%v: no route from %v to %v, expected %v steps", name, from, to, steps)
+	}
+	if route.Square() != from || route.Len() != steps {
+		t.Fatalf("%v: route %v from %v to %v, expected %v steps", name, route, from, to, steps)
+	}
+
+	last := route
+	for ; last.Next() != nil; last = last.Next() {
+		if !last.Square().Neighbors().Member(last.NextSquare()) {
+			t.Fatalf("%v: route %v steps from %v to %v, which aren't adjacent", name, route, last.Square(), last.NextSquare())
+		}
+	}
+	if last.Square() != to {
+		t.Fatalf("%v: route %v ends at %v, not %v", name, route, last.Square(), to)
+	}
+}
+
+func TestPathsAreShortest(t *testing.T) {
+	s := randomState(30, 40, 0.3, 1)
+	land := landSquares(s)
+
+	random := rand.New(rand.NewSource(2))
+	unreachable := 0
+	for i := 0; i < 300; i++ {
+		from, to := land[random.Intn(len(land))], land[random.Intn(len(land))]
+		steps := bfsSteps(s, from, to)
+		astar := FindPath(s, from, to, DefaultPathOptions)
+		bidirectional := FindPathBidirectional(s, from, to, DefaultPathOptions)
+
+		if steps < 0 {
+			unreachable++
+			if astar != nil || bidirectional != nil {
+				t.Fatalf("found a route from %v to %v where there isn't one: %v, %v", from, to, astar, bidirectional)
+			}
+			continue
+		}
+		checkPath(t, "FindPath", astar, from, to, steps)
+		checkPath(t, "FindPathBidirectional", bidirectional, from, to, steps)
+	}
+
+	if unreachable == 0 {
+		t.Errorf("expected some of the pairs to be cut off by water")
+	}
+}
+
+func TestPathsWrapAround(t *testing.T) {
+	s := textState(
+		"..........",
+		".%%%%%%%%.",
+		".%%%%%%%%.",
+		".%%%%%%%%.",
+		"..........")
+
+	// across the left and right edges, and across the top and bottom
+	pairs := [][5]int{{2, 0, 2, 9, 1}, {0, 4, 4, 4, 1}, {0, 0, 4, 9, 2}}
+	for _, pair := range pairs {
+		from, to := s.SquareAtRowCol(pair[0], pair[1]), s.SquareAtRowCol(pair[2], pair[3])
+		checkPath(t, "FindPath", FindPath(s, from, to, DefaultPathOptions), from, to, pair[4])
+		checkPath(t, "FindPathBidirectional", FindPathBidirectional(s, from, to, DefaultPathOptions), from, to, pair[4])
+	}
+}
+
+func TestPathsToUnreachableSquares(t *testing.T) {
+	s := textState(
+		".....",
+		".%%%.",
+		".%.%.",
+		".%%%.",
+		".....")
+	from, walledIn := s.SquareAtRowCol(0, 0), s.SquareAtRowCol(2, 2)
+
+	if route := FindPath(s, from, walledIn, DefaultPathOptions); route != nil {
+		t.Errorf("FindPath found %v", route)
+	}
+	if route := FindPathBidirectional(s, from, walledIn, DefaultPathOptions); route != nil {
+		t.Errorf("FindPathBidirectional found %v", route)
+	}
+}
+
+// Popping a stale entry, left behind when a cheaper way to its square
+// turned up, isn't an expansion
+func TestBidirectionalExpansionLimit(t *testing.T) {
+	// the unobserved squares in the two lanes get pushed at a high cost
+	// and then again at a lower one, leaving stale entries in the heaps
+	s := textState(
+		"%%%%%%%%%%%%%%%%",
+		"%.....??.??%%%%%",
+		"%...??....?.....",
+		"%%%%%%%%%%%%....",
+		"%%%%%%%%%%%%....",
+		"%%%%%%%%%%%%%%%%")
+	from, to := s.SquareAtRowCol(4, 14), s.SquareAtRowCol(2, 1)
+
+	// expansion order depends on map iteration, so try it a few times;
+	// counting the stale pops as well takes at least 31
+	for i := 0; i < 20; i++ {
+		if route := FindPathBidirectional(s, from, to, &PathOptions{PenalizeUnobserved, 5, 30}); route == nil {
+			t.Fatalf("no route within 30 expansions")
+		}
+	}
+}
+
+func TestPathsToWater(t *testing.T) {
+	s := textState(
+		"...",
+		".%.",
+		"...")
+	from, water := s.SquareAtRowCol(0, 0), s.SquareAtRowCol(1, 1)
+	if route := FindPath(s, from, water, DefaultPathOptions); route != nil {
+		t.Errorf("FindPath found %v", route)
+	}
+	if route := FindPathBidirectional(s, from, water, DefaultPathOptions); route != nil {
+		t.Errorf("FindPathBidirectional found %v", route)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+)
+
+// ProfileCommand is `MyBot profile [flags] FILE [N]`: replay a recording
+// N times (10 by default) under the CPU profiler, then write a heap
+// profile. Every run ignores the time budget and takes its randomness
+// from the recorded player_seed. A game that ran short of time when it
+// was recorded gives different orders without the budget, so a run that
+// differs from the recording is only a warning unless -strict is given.
+func ProfileCommand(args []string) os.Error {
+	strict := false
+	config, flags, err := ParseConfig("profile", args, func(flags *flag.FlagSet) {
+		flags.BoolVar(&strict, "strict", false, "fail if a run doesn't give the recorded orders")
+	})
+	if err != nil {
+		return err
+	}
+
+	loops := 10
+	if flags.NArg() == 2 {
+		loops, err = strconv.Atoi(flags.Arg(1))
+		if err != nil || loops < 1 {
+			return os.NewError("profile: N must be a positive number")
+		}
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		return os.NewError("usage: MyBot profile [flags] FILE [N]")
+	}
+	config.Replay = flags.Arg(0)
+
+	return Profile(config, loops, strict)
+}
+
+// Profile replays config.Replay loops times, profiling to
+// config.CPUProfile and config.MemProfile. If strict, a run that doesn't
+// give the recorded orders is an error; otherwise the first difference
+// is printed as a warning.
+func Profile(config *Config, loops int, strict bool) os.Error {
+	recording, err := LoadRecording(config.Replay)
+	if err != nil {
+		return err
+	}
+	config.IgnoreTimeBudget = true
+
+	cpu, err := os.Create(config.CPUProfile)
+	if err != nil {
+		return err
+	}
+	defer cpu.Close()
+
+	err = pprof.StartCPUProfile(cpu)
+	if err != nil {
+		return err
+	}
+
+	times := make(int64List, loops)
+	diverged := 0
+	for i := range times {
+		var turns [][]string
+		times[i], turns, err = recording.Run(config)
+		if err == nil {
+			err = recording.Compare(turns)
+			if err != nil && !strict {
+				if diverged == 0 {
+					fmt.Fprintf(os.Stderr, "profile: warning: run %v: %v\n", i+1, err)
+				}
+				diverged++
+				err = nil
+			}
+		}
+		if err != nil {
+			pprof.StopCPUProfile()
+			return os.NewError(fmt.Sprintf("profile: run %v: %v", i+1, err))
+		}
+	}
+	pprof.StopCPUProfile()
+
+	mem, err := os.Create(config.MemProfile)
+	if err != nil {
+		return err
+	}
+	defer mem.Close()
+
+	runtime.GC()
+	err = pprof.WriteHeapProfile(mem)
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(times)
+	fmt.Printf("profile: %v runs of %v turns (min %.1fms, median %.1fms, max %.1fms), wrote %v and %v\n",
+		loops, len(recording.Orders)-1, (float64)(times[0])/1e6, (float64)(Percentile(times, 50))/1e6,
+		(float64)(times[len(times)-1])/1e6, config.CPUProfile, config.MemProfile)
+	if diverged > 0 {
+		fmt.Printf("profile: %v of %v runs differed from the recording\n", diverged, loops)
+	}
+
+	return nil
+}
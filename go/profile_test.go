@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// divergentRecording records a game of testdata/protocol/game.txt, adds
+// an order we never gave on turn 1, and returns the directory it's in
+func divergentRecording(t *testing.T) string {
+	input, err := ioutil.ReadFile("testdata/protocol/game.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var recorded, output bytes.Buffer
+	rec := NewRecorder(&recorded)
+	err = Play(NewSession(io.TeeReader(bytes.NewBuffer(input), rec.Input), io.MultiWriter(&output, rec.Output)), DefaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Flush()
+
+	// the first "> go" ends the setup turn, the second turn 1
+	lines := strings.SplitAfter(recorded.String(), "\n")
+	gos := 0
+	for i, line := range lines {
+		if line == "> go\n" {
+			gos++
+			if gos == 2 {
+				lines[i] = "> o 0 0 n\n" + line
+				break
+			}
+		}
+	}
+	if gos < 2 {
+		t.Fatalf("recording has no turn 1")
+	}
+
+	dir, err := ioutil.TempDir("", "profile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "game.rec"), []byte(strings.Join(lines, "")), 0644)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestProfileDivergent(t *testing.T) {
+	dir := divergentRecording(t)
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.Replay = filepath.Join(dir, "game.rec")
+	config.CPUProfile = filepath.Join(dir, "cpu.prof")
+	config.MemProfile = filepath.Join(dir, "mem.prof")
+
+	if err := Profile(config, 2, false); err != nil {
+		t.Errorf("Profile: %v", err)
+	}
+	for _, name := range []string{config.CPUProfile, config.MemProfile} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("no profile written: %v", err)
+		}
+	}
+
+	err := Profile(config, 2, true)
+	if err == nil || !strings.Contains(err.String(), "turn 1 differs") {
+		t.Errorf("strict Profile gave %v, want turn 1 to differ", err)
+	}
+}
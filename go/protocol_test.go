@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"rand"
+	"strings"
+	"testing"
+)
+
+// protocolHeader is the start of a game on a 20x20 map, up to and
+// including line 11, "ready"
+const protocolHeader = "turn 0\nloadtime 3000\nturntime 1000\nrows 20\ncols 20\nturns 10\n" +
+	"viewradius2 55\nattackradius2 5\nspawnradius2 1\nplayer_seed 42\nready\n"
+
+// playProtocol plays input as MyBot and returns the error it ends with,
+// having first forgotten the goals and items of the last game played
+func playProtocol(input []byte) os.Error {
+	AllItems = make(ItemSet)
+	AllGoals = make(map[GoalId]Goal)
+	EatIndex = make(map[*Square]map[*Food]*Eat)
+	ExploreIndex = make(map[*Square]*Explore)
+	RazeIndex = make(map[*Square]*Raze)
+
+	var out bytes.Buffer
+	return Play(NewSession(bytes.NewBuffer(input), &out), DefaultConfig())
+}
+
+var protocolErrorTests = []struct {
+	input string
+	line  int
+	turn  int
+	text  string
+}{
+	{"rows x\nready\n", 1, 0, "rows x"},
+	{"rows 20\ncols\n", 2, 0, "cols"},
+	{"player_seed 1.5\n", 1, 0, "player_seed 1.5"},
+	{"turn 3\n", 1, 0, "turn 3"},
+	{"rows 20\nready\n", 2, 0, "ready"},
+	{"rows 20\ncols 20\n", 2, 0, ""},
+	{protocolHeader + "turn one\n", 12, 0, "turn one"},
+	{protocolHeader + "turn 2\n", 12, 0, "turn 2"},
+	{protocolHeader + "turn 1\nf 3\n", 13, 1, "f 3"},
+	{protocolHeader + "turn 1\nf 3 x\n", 13, 1, "f 3 x"},
+	{protocolHeader + "turn 1\na 1 1 -1\n", 13, 1, "a 1 1 -1"},
+	{protocolHeader + "turn 1\nw 20 1\n", 13, 1, "w 20 1"},
+	{protocolHeader + "turn 1\nh -1 1 0\n", 13, 1, "h -1 1 0"},
+	{protocolHeader + "turn 1\ngo\nturn 2\nd 1 1\n", 15, 2, "d 1 1"},
+	{protocolHeader + "turn 1\r\nf 3\r\n", 13, 1, "f 3"},
+	{protocolHeader + "turn 1\ngo\nend\n", 14, 1, "end"},
+	{protocolHeader + "turn 1\ngo\nend\ngo\n", 15, 1, "end"},
+	{protocolHeader + "turn 1\ngo\nend\nplayers 2\ngo\n", 16, 1, "end"},
+	{protocolHeader + "turn 1\ngo\nend\nplayers 2\nscore 1\ngo\n", 17, 1, "end"},
+	{protocolHeader + "turn 1\ngo\nend\nplayers two\n", 15, 1, "players two"},
+}
+
+func TestProtocolErrors(t *testing.T) {
+	for _, test := range protocolErrorTests {
+		err := playProtocol([]byte(test.input))
+		protocolErr, ok := err.(*ProtocolError)
+		if !ok {
+			t.Errorf("%q: got %v, expected a protocol error", test.input, err)
+			continue
+		}
+		if protocolErr.Line != test.line || protocolErr.Turn != test.turn || protocolErr.Text != test.text {
+			t.Errorf("%q: line %v, turn %v, text %q; expected line %v, turn %v, text %q", test.input, protocolErr.Line, protocolErr.Turn, protocolErr.Text, test.line, test.turn, test.text)
+		}
+	}
+}
+
+// Unknown parameters and commands are skipped, as are extra arguments
+func TestProtocolIgnoresUnknown(t *testing.T) {
+	input := "rows 10\ncols 12\ngame_id abc def\nnew_param 5\nready\n" +
+		"turn 1\nbar 1 2\nf 1 1 extra\na 2 2 0 9\nz\ngo\n"
+	if err := playProtocol([]byte(input)); err != nil && err != os.EOF {
+		t.Errorf("%v", err)
+	}
+}
+
+// The number of mutations of each input in testdata/protocol to play
+const protocolMutations = 100
+
+// TestProtocolCorpus plays the seed inputs in testdata/protocol, then
+// mangled copies of them. A seed named bad_*.txt must end in a protocol
+// error and any other seed must play through; no input may panic.
+func TestProtocolCorpus(t *testing.T) {
+	filenames, err := filepath.Glob("testdata/protocol/*.txt")
+	if err != nil {
+		t.Fatalf("Glob: %v", err)
+	}
+	if len(filenames) == 0 {
+		t.Fatalf("no inputs in testdata/protocol")
+	}
+
+	random := rand.New(rand.NewSource(1))
+	for _, filename := range filenames {
+		input, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatalf("%v: %v", filename, err)
+		}
+
+		err = playSafely(input)
+		_, isProtocolError := err.(*ProtocolError)
+		if strings.HasPrefix(filepath.Base(filename), "bad_") {
+			if !isProtocolError {
+				t.Errorf("%v: got %v, expected a protocol error", filename, err)
+			}
+		} else if err != nil && err != os.EOF {
+			t.Errorf("%v: %v", filename, err)
+		}
+
+		for i := 0; i < protocolMutations; i++ {
+			mutant := mutate(random, input)
+			if err := playSafely(mutant); err != nil {
+				if _, panicked := err.(panicError); panicked {
+					t.Fatalf("%v mutated to %q: %v", filename, mutant, err)
+				}
+			}
+		}
+	}
+}
+
+// A panicError is a panic caught by playSafely
+type panicError string
+
+func (err panicError) String() string {
+	return string(err)
+}
+
+// playSafely plays input and returns the error the game ends with, or a
+// panicError if it panics
+func playSafely(input []byte) (err os.Error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(fmt.Sprintf("panic: %v", e))
+		}
+	}()
+	return playProtocol(input)
+}
+
+// mutate is input with a few bytes changed, dropped or added, favouring
+// the characters the protocol is made of
+func mutate(random *rand.Rand, input []byte) []byte {
+	const alphabet = "0123456789 -\r\nafhdw"
+	mutant := append([]byte{}, input...)
+	for n := 1 + random.Intn(4); n > 0 && len(mutant) > 0; n-- {
+		i := random.Intn(len(mutant))
+		switch random.Intn(3) {
+		case 0:
+			mutant[i] = alphabet[random.Intn(len(alphabet))]
+		case 1:
+			mutant = append(mutant[:i], mutant[i+1:]...)
+		case 2:
+			mutant = append(mutant[:i], append([]byte{alphabet[random.Intn(len(alphabet))]}, mutant[i:]...)...)
+		}
+	}
+	return mutant
+}
+
+func TestGameResultRank(t *testing.T) {
+	tests := []struct {
+		scores []int
+		rank   int
+	}{
+		{[]int{}, 0},
+		{[]int{3}, 1},
+		{[]int{3, 1, 2}, 1},
+		{[]int{1, 3, 2}, 3},
+		{[]int{2, 3, 2, 3}, 3},
+		{[]int{2, 2}, 1},
+	}
+	for _, test := range tests {
+		result := &GameResult{100, len(test.scores), test.scores}
+		if rank := result.Rank(); rank != test.rank {
+			t.Errorf("scores %v: rank %v, expected %v", test.scores, rank, test.rank)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import "math"
+
+// Starting ratings: Elo's usual 1500, and TrueSkill's mu 25 and sigma
+// 25/3, so that mu - 3 sigma starts at zero
+const (
+	eloStart     = 1500.0
+	eloK         = 32.0
+	trueSkillMu  = 25.0
+	trueSkillSig = trueSkillMu / 3
+	trueSkillBet = trueSkillSig / 2   // performance noise in a single game
+	trueSkillTau = trueSkillSig / 100 // skill drift between games
+)
+
+// Rating is how well one bot has done over all its games, in two
+// systems: Elo, and an approximation of TrueSkill that treats a game of
+// several players as a win for each player over the one ranked just
+// below it. TrueSkill also says how sure it is, so the leaderboard is
+// ordered by Conservative.
+type Rating struct {
+	Name    string
+	Games   int
+	Elo     float64
+	Mu      float64
+	Sigma   float64
+	RankSum int // sum of finishing places, 1 for first
+}
+
+func NewRating(name string) *Rating {
+	return &Rating{Name: name, Elo: eloStart, Mu: trueSkillMu, Sigma: trueSkillSig}
+}
+
+// Conservative is a skill the bot almost certainly has
+func (rating *Rating) Conservative() float64 {
+	return rating.Mu - 3*rating.Sigma
+}
+
+func (rating *Rating) MeanRank() float64 {
+	if rating.Games == 0 {
+		return 0
+	}
+	return (float64)(rating.RankSum) / (float64)(rating.Games)
+}
+
+// UpdateRatings rates one game: ratings[i] finished with scores[i], and
+// higher scores are better
+func UpdateRatings(ratings []*Rating, scores []int) {
+	n := len(ratings)
+	if n < 2 {
+		return
+	}
+
+	// places, with ties sharing the better place
+	ranks := make([]int, n)
+	for i := range ratings {
+		ranks[i] = 1
+		for j := range ratings {
+			if scores[j] > scores[i] {
+				ranks[i]++
+			}
+		}
+		ratings[i].Games++
+		ratings[i].RankSum += ranks[i]
+	}
+
+	updateElo(ratings, ranks)
+	updateTrueSkill(ratings, ranks)
+}
+
+// updateElo plays every pair of players off against each other, with K
+// shared out so that a game is worth the same whatever the player count
+func updateElo(ratings []*Rating, ranks []int) {
+	n := len(ratings)
+	k := eloK / (float64)(n-1)
+	deltas := make([]float64, n)
+	for i := range ratings {
+		for j := range ratings {
+			if i == j {
+				continue
+			}
+
+			actual := 0.5
+			if ranks[i] < ranks[j] {
+				actual = 1
+			} else if ranks[i] > ranks[j] {
+				actual = 0
+			}
+			expected := 1 / (1 + math.Pow(10, (ratings[j].Elo-ratings[i].Elo)/400))
+			deltas[i] += k * (actual - expected)
+		}
+	}
+
+	for i, rating := range ratings {
+		rating.Elo += deltas[i]
+	}
+}
+
+// updateTrueSkill updates each player against the players placed
+// directly above and below it
+func updateTrueSkill(ratings []*Rating, ranks []int) {
+	n := len(ratings)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	for i := 1; i < n; i++ {
+		for j := i; j > 0 && ranks[order[j]] < ranks[order[j-1]]; j-- {
+			order[j], order[j-1] = order[j-1], order[j]
+		}
+	}
+
+	mus := make([]float64, n)
+	sigmas := make([]float64, n)
+	for i, rating := range ratings {
+		mus[i] = rating.Mu
+		sigmas[i] = math.Sqrt(rating.Sigma*rating.Sigma + trueSkillTau*trueSkillTau)
+	}
+
+	muDeltas := make([]float64, n)
+	varianceFactors := make([]float64, n)
+	for i := range varianceFactors {
+		varianceFactors[i] = 1
+	}
+
+	for place := 0; place < n-1; place++ {
+		winner, loser := order[place], order[place+1]
+		c := math.Sqrt(2*trueSkillBet*trueSkillBet + sigmas[winner]*sigmas[winner] + sigmas[loser]*sigmas[loser])
+		t := (mus[winner] - mus[loser]) / c
+
+		var v, w float64
+		if ranks[winner] == ranks[loser] {
+			v, w = drawVW(t)
+		} else {
+			v, w = winVW(t)
+		}
+
+		winnerVariance := sigmas[winner] * sigmas[winner]
+		loserVariance := sigmas[loser] * sigmas[loser]
+		muDeltas[winner] += winnerVariance / c * v
+		muDeltas[loser] -= loserVariance / c * v
+		varianceFactors[winner] *= 1 - winnerVariance/(c*c)*w
+		varianceFactors[loser] *= 1 - loserVariance/(c*c)*w
+	}
+
+	for i, rating := range ratings {
+		rating.Mu = mus[i] + muDeltas[i]
+		rating.Sigma = sigmas[i] * math.Sqrt(math.Fmax(varianceFactors[i], 0.0001))
+	}
+}
+
+func normalPdf(x float64) float64 {
+	return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi)
+}
+
+func normalCdf(x float64) float64 {
+	return math.Erfc(-x/math.Sqrt2) / 2
+}
+
+// winVW are TrueSkill's corrections to the mean and variance when the
+// player ahead by t won
+func winVW(t float64) (float64, float64) {
+	cdf := normalCdf(t)
+	if cdf < 1e-12 {
+		// a huge upset; the limit of v as t goes to -infinity
+		return -t, 1
+	}
+
+	v := normalPdf(t) / cdf
+	return v, v * (v + t)
+}
+
+// drawVW are rough corrections for a draw: the means move halfway
+// towards each other, and the variance shrinks as for an even game
+func drawVW(t float64) (float64, float64) {
+	_, w := winVW(0)
+	return -t / 2, w
+}
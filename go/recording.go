@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A recording (made with `MyBot -record FILE`) is a transcript of one
+// game from our side of the pipe:
+//
+//   < turn 1        a line the engine sent us
+//   > o 10 12 n     a line we sent back
+//   = 1534000       nanoseconds between the engine's "go" and ours
+//
+// Replaying it feeds the "<" lines back through the bot (which reseeds
+// from player_seed) and checks that every turn produces the same orders.
+
+type Recorder struct {
+	w         *bufio.Writer
+	turnStart int64
+	Input     io.Writer // tee engine input through here
+	Output    io.Writer // tee our output through here
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	rec := &Recorder{w: bufio.NewWriter(w)}
+	rec.Input = &recordedStream{rec, "< ", nil}
+	rec.Output = &recordedStream{rec, "> ", nil}
+	return rec
+}
+
+func (rec *Recorder) line(prefix, line string) {
+	rec.w.WriteString(prefix)
+	rec.w.WriteString(line)
+	rec.w.WriteByte('\n')
+
+	switch {
+	case prefix == "< " && (line == "ready" || line == "go"):
+		rec.turnStart = time.Nanoseconds()
+	case prefix == "> " && line == "go":
+		fmt.Fprintf(rec.w, "= %v\n", time.Nanoseconds()-rec.turnStart)
+		// flush every turn so a crash still leaves a useful recording
+		rec.w.Flush()
+	}
+}
+
+func (rec *Recorder) Flush() os.Error {
+	return rec.w.Flush()
+}
+
+// recordedStream splits whatever is written to it into lines for the
+// recorder, holding on to any trailing partial line
+type recordedStream struct {
+	rec     *Recorder
+	prefix  string
+	partial []byte
+}
+
+func (stream *recordedStream) Write(p []byte) (int, os.Error) {
+	stream.partial = append(stream.partial, p...)
+	for {
+		i := bytes.IndexByte(stream.partial, '\n')
+		if i < 0 {
+			break
+		}
+
+		stream.rec.line(stream.prefix, strings.TrimRight(string(stream.partial[:i]), "\r"))
+		stream.partial = stream.partial[i+1:]
+	}
+
+	return len(p), nil
+}
+
+type Recording struct {
+	Input  []string   // engine lines, in order
+	Orders [][]string // our lines for each turn (setup is turn 0), up to and including "go"
+	Nanos  []int64    // time we took on each turn
+}
+
+func LoadRecording(filename string) (*Recording, os.Error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	recording := &Recording{make([]string, 0), make([][]string, 0), make([]int64, 0)}
+	orders := make([]string, 0)
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err == os.EOF && line == "" {
+			break
+		}
+		if err != nil && err != os.EOF {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if len(line) < 2 {
+			return nil, os.NewError(fmt.Sprintf("recording: line %v: invalid line %q", lineNumber, line))
+		}
+
+		switch line[:2] {
+		case "< ":
+			recording.Input = append(recording.Input, line[2:])
+		case "> ":
+			orders = append(orders, line[2:])
+			if line[2:] == "go" {
+				recording.Orders = append(recording.Orders, orders)
+				orders = make([]string, 0)
+			}
+		case "= ":
+			nanos, convErr := strconv.Atoi64(line[2:])
+			if convErr != nil {
+				return nil, os.NewError(fmt.Sprintf("recording: line %v: invalid time %q", lineNumber, line[2:]))
+			}
+			recording.Nanos = append(recording.Nanos, nanos)
+		default:
+			return nil, os.NewError(fmt.Sprintf("recording: line %v: invalid line %q", lineNumber, line))
+		}
+	}
+
+	return recording, nil
+}
+
+// InputString is everything the engine sent, ready to feed to the bot
+func (recording *Recording) InputString() string {
+	return strings.Join(recording.Input, "\n") + "\n"
+}
+
+// SplitTurns breaks output into one list of lines per turn, like Orders
+func SplitTurns(output string) [][]string {
+	turns := make([][]string, 0)
+	orders := make([]string, 0)
+	for _, line := range strings.Split(output, "\n") {
+		if line == "" {
+			continue
+		}
+
+		orders = append(orders, line)
+		if line == "go" {
+			turns = append(turns, orders)
+			orders = make([]string, 0)
+		}
+	}
+
+	return turns
+}
+
+// Compare checks each turn of output against the recorded orders,
+// ignoring the order orders were given in, and describes the first
+// difference
+func (recording *Recording) Compare(turns [][]string) os.Error {
+	for turn := 0; turn < len(recording.Orders) || turn < len(turns); turn++ {
+		if turn >= len(turns) {
+			return os.NewError(fmt.Sprintf("replay: bot stopped after turn %v, recording has %v turns", turn-1, len(recording.Orders)-1))
+		}
+		if turn >= len(recording.Orders) {
+			return os.NewError(fmt.Sprintf("replay: bot kept going after the recording ended at turn %v", turn-1))
+		}
+
+		expected, actual := sortedCopy(recording.Orders[turn]), sortedCopy(turns[turn])
+		if strings.Join(expected, "\n") != strings.Join(actual, "\n") {
+			return os.NewError(fmt.Sprintf("replay: turn %v differs\nrecorded: %v\nreplayed: %v", turn, expected, actual))
+		}
+	}
+
+	return nil
+}
+
+func sortedCopy(lines []string) []string {
+	result := make([]string, len(lines))
+	copy(result, lines)
+	sort.Strings(result)
+	return result
+}
+
+// Record plays a game over stdin and stdout as usual, recording it to
+// config.Record
+func Record(config *Config) os.Error {
+	file, err := os.Create(config.Record)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	rec := NewRecorder(file)
+	defer rec.Flush()
+
+	return Play(NewSession(io.TeeReader(os.Stdin, rec.Input), io.MultiWriter(os.Stdout, rec.Output)), config)
+}
+
+// Replay plays the recorded input through a fresh bot, checks it gives
+// the recorded orders, and says how long that took
+func (recording *Recording) Replay(config *Config) (int64, os.Error) {
+	elapsed, turns, err := recording.Run(config)
+	if err != nil {
+		return 0, err
+	}
+
+	return elapsed, recording.Compare(turns)
+}
+
+// Run plays the recorded input through a fresh bot and returns how long
+// that took and the orders it gave each turn
+func (recording *Recording) Run(config *Config) (int64, [][]string, os.Error) {
+	var output bytes.Buffer
+
+	start := time.Nanoseconds()
+	err := Play(NewSession(strings.NewReader(recording.InputString()), &output), config)
+	if err != nil {
+		return 0, nil, err
+	}
+	elapsed := time.Nanoseconds() - start
+
+	return elapsed, SplitTurns(output.String()), nil
+}
+
+// ReplayCommand is `MyBot replay [flags] FILE`, short for
+// `MyBot -replay FILE [flags]`
+func ReplayCommand(args []string) os.Error {
+	config, flags, err := ParseConfig("replay", args, nil)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() == 1 {
+		config.Replay = flags.Arg(0)
+	}
+	if config.Replay == "" || flags.NArg() > 1 {
+		return os.NewError("usage: MyBot replay [flags] FILE")
+	}
+
+	return Replay(config)
+}
+
+// Replay plays the game recorded in config.Replay again and checks we
+// give the same orders. The time budget is ignored so that the result
+// doesn't depend on how fast this machine is; a recording of a game
+// where we ran out of time may legitimately differ.
+func Replay(config *Config) os.Error {
+	recording, err := LoadRecording(config.Replay)
+	if err != nil {
+		return err
+	}
+
+	config.IgnoreTimeBudget = true
+	elapsed, err := recording.Replay(config)
+	if err != nil {
+		return err
+	}
+
+	recorded := int64(0)
+	for _, nanos := range recording.Nanos {
+		recorded += nanos
+	}
+	fmt.Printf("replay: %v turns match (%.1fms recorded, %.1fms replayed)\n",
+		len(recording.Orders)-1, (float64)(recorded)/1e6, (float64)(elapsed)/1e6)
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import "strings"
+
+// A Route is a path from square to a goal's destination. Each route
+// points at the route from the next square along, so search nodes and
+// squares that share a tail share the memory for it too.
+type Route struct {
+	square *Square
+	next   *Route
+	length int
+}
+
+func NewRoute(square *Square, next *Route) *Route {
+	if next == nil {
+		return &Route{square, nil, 0}
+	}
+
+	return &Route{square, next, next.length + 1}
+}
+
+// Len is the number of steps left to the destination
+func (route *Route) Len() int {
+	if route == nil {
+		return 0
+	}
+
+	return route.length
+}
+
+func (route *Route) Square() *Square {
+	return route.square
+}
+
+func (route *Route) Next() *Route {
+	if route == nil {
+		return nil
+	}
+
+	return route.next
+}
+
+// NextSquare is where to step to follow the route, or nil if there's
+// nowhere left to go
+func (route *Route) NextSquare() *Square {
+	next := route.Next()
+	if next == nil {
+		return nil
+	}
+
+	return next.square
+}
+
+func (route *Route) String() string {
+	squares := make([]string, 0)
+	for step := route; step != nil; step = step.next {
+		squares = append(squares, step.square.String())
+	}
+
+	return "(" + strings.Join(squares, " ") + ")"
+}
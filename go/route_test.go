@@ -0,0 +1,176 @@
+package main
+
+import (
+	"rand"
+	"testing"
+)
+
+// randomState is a rows x cols map, all of it observed, where each square
+// is water with probability water
+func randomState(rows, cols int, water float64, seed int64) *State {
+	random := rand.New(rand.NewSource(seed))
+	s := &State{Rows: rows, Cols: cols, ViewRadius2: 55}
+	s.CreateSquares()
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			s.SquareAtRowCol(row, col).Observe(s)
+		}
+	}
+
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			if random.Float64() < water {
+				s.SquareAtRowCol(row, col).Destroy()
+			}
+		}
+	}
+	return s
+}
+
+// isLand is whether square isn't water
+func isLand(square *Square) bool {
+	return !square.IsWater()
+}
+
+// landSquares are the squares that aren't water, in row order
+func landSquares(s *State) []*Square {
+	land := make([]*Square, 0)
+	for row := 0; row < s.Rows; row++ {
+		for col := 0; col < s.Cols; col++ {
+			if square := s.SquareAtRowCol(row, col); isLand(square) {
+				land = append(land, square)
+			}
+		}
+	}
+	return land
+}
+
+// largeState is a 200x200 map shared by the benchmarks, since making it
+// takes a while
+var largeState *State
+
+func largeMap() *State {
+	if largeState == nil {
+		largeState = randomState(200, 200, 0.1, 1)
+	}
+	return largeState
+}
+
+// sharedRoutes searches out from source, giving each square a route back
+// to it the way the distance fields do: one new node per square, pointing
+// at its parent's route
+func sharedRoutes(s *State, source *Square) []*Route {
+	routes := make([]*Route, s.Rows*s.Cols)
+	routes[source.location] = NewRoute(source, nil)
+	queue := []*Square{source}
+	for len(queue) > 0 {
+		square := queue[0]
+		queue = queue[1:]
+		for _, neighbor := range square.Neighbors() {
+			if routes[neighbor.location] == nil {
+				routes[neighbor.location] = NewRoute(neighbor, routes[square.location])
+				queue = append(queue, neighbor)
+			}
+		}
+	}
+	return routes
+}
+
+// copiedRoutes is the same search with each square keeping its own copy
+// of the whole path, the way routes were stored before they were shared
+func copiedRoutes(s *State, source *Square) [][]*Square {
+	routes := make([][]*Square, s.Rows*s.Cols)
+	routes[source.location] = []*Square{source}
+	queue := []*Square{source}
+	for len(queue) > 0 {
+		square := queue[0]
+		queue = queue[1:]
+		for _, neighbor := range square.Neighbors() {
+			if routes[neighbor.location] == nil {
+				route := make([]*Square, 0, len(routes[square.location])+1)
+				route = append(route, neighbor)
+				route = append(route, routes[square.location]...)
+				routes[neighbor.location] = route
+				queue = append(queue, neighbor)
+			}
+		}
+	}
+	return routes
+}
+
+func TestSharedRoutesMatchCopiedRoutes(t *testing.T) {
+	s := randomState(40, 50, 0.3, 1)
+	source := landSquares(s)[0]
+	shared := sharedRoutes(s, source)
+	copied := copiedRoutes(s, source)
+
+	for _, square := range landSquares(s) {
+		i := square.location
+		if (shared[i] == nil) != (copied[i] == nil) {
+			t.Fatalf("%v: reached by one search and not the other", square)
+		}
+		if shared[i] == nil {
+			continue
+		}
+
+		if shared[i].Len() != len(copied[i])-1 {
+			t.Fatalf("%v: shared route has %v steps, copied route %v", square, shared[i].Len(), len(copied[i])-1)
+		}
+		last := shared[i]
+		for last.Next() != nil {
+			if !last.Square().Neighbors().Member(last.NextSquare()) {
+				t.Fatalf("%v: route %v steps between squares that aren't adjacent", square, shared[i])
+			}
+			last = last.Next()
+		}
+		if last.Square() != source {
+			t.Fatalf("%v: route ends at %v, not %v", square, last.Square(), source)
+		}
+	}
+}
+
+func BenchmarkSharedRoutes(b *testing.B) {
+	b.StopTimer()
+	s := largeMap()
+	source := landSquares(s)[0]
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		sharedRoutes(s, source)
+	}
+}
+
+func BenchmarkCopiedRoutes(b *testing.B) {
+	b.StopTimer()
+	s := largeMap()
+	source := landSquares(s)[0]
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		copiedRoutes(s, source)
+	}
+}
+
+// BenchmarkDistanceField fills a whole field from a target in each
+// quarter of the map through the search queue, as a turn would
+func BenchmarkDistanceField(b *testing.B) {
+	b.StopTimer()
+	s := largeMap()
+	land := landSquares(s)
+	targets := make([]Goal, 4)
+	for i := range targets {
+		targets[i] = NewExplore(land[i*len(land)/len(targets)])
+	}
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		queue := NewSearchQueue()
+		field := NewDistanceField(s, ExploreType, queue)
+		for _, target := range targets {
+			field.AddTarget(target)
+		}
+		for queue.Len() > 0 {
+			field.Visit(queue.Pop())
+		}
+	}
+}
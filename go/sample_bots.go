@@ -0,0 +1,354 @@
+package main
+
+import (
+	"os"
+	"sort"
+)
+
+// SampleBots are simple opponents with different styles, for
+// benchmarking without Python. Any of them plays in place of MyBot with
+// `MyBot -bot NAME`, so the engine (or a tournament) can run it as a
+// bot of its own, and Replay, view and the rest work with it in-process.
+//
+//   random     every ant wanders at random
+//   greedy     ants head for the nearest food, and explore when there's none
+//   hunter     ants chase enemy ants and hills, then food, then explore
+//   turtle     ants never go far from home: they fight intruders and eat
+//              food nearby, and otherwise mill about their hills
+//   holdhills  ants stand on the corners of our hills, up to half of
+//              them; the rest go after enemy hills, food and then the
+//              unknown
+var SampleBots = map[string]func(s *State, config *Config) Bot{
+	"greedy":    NewGreedyBot,
+	"holdhills": NewHoldHillsBot,
+	"hunter":    NewHunterBot,
+	"random":    NewRandomBot,
+	"turtle":    NewTurtleBot,
+}
+
+// How far the turtle lets its ants stray from its hills, in steps
+const TurtleRange = 10
+
+// NewConfiguredBot is MyBot, or the sample bot config.Bot names
+func NewConfiguredBot(s *State, config *Config) Bot {
+	if newBot, ok := SampleBots[config.Bot]; ok {
+		Log.Infof("Game: Playing as the %v sample bot", config.Bot)
+		return newBot(s, config)
+	}
+	return NewBot(s, config)
+}
+
+type RandomBot struct{}
+
+func NewRandomBot(s *State, config *Config) Bot {
+	s.Config = config
+	return new(RandomBot)
+}
+
+func (bot *RandomBot) DoTurn(s *State) os.Error {
+	for _, ant := range sampleAnts(s) {
+		wander(s, ant, nil)
+	}
+	return nil
+}
+
+type GreedyBot struct{}
+
+func NewGreedyBot(s *State, config *Config) Bot {
+	s.Config = config
+	return new(GreedyBot)
+}
+
+func (bot *GreedyBot) DoTurn(s *State) os.Error {
+	food := stepsFrom(s, foodSquares(), 0)
+	fog := stepsFrom(s, fogSquares(s), 0)
+	for _, ant := range sampleAnts(s) {
+		seek(s, ant, food, fog)
+	}
+	return nil
+}
+
+type HunterBot struct{}
+
+func NewHunterBot(s *State, config *Config) Bot {
+	s.Config = config
+	return new(HunterBot)
+}
+
+func (bot *HunterBot) DoTurn(s *State) os.Error {
+	prey := stepsFrom(s, append(enemyAntSquares(s), hillSquares(false)...), 0)
+	food := stepsFrom(s, foodSquares(), 0)
+	fog := stepsFrom(s, fogSquares(s), 0)
+	for _, ant := range sampleAnts(s) {
+		seek(s, ant, prey, food, fog)
+	}
+	return nil
+}
+
+type TurtleBot struct {
+	hunter *HunterBot // what we do once we've no hills left to guard
+}
+
+func NewTurtleBot(s *State, config *Config) Bot {
+	s.Config = config
+	return &TurtleBot{new(HunterBot)}
+}
+
+func (bot *TurtleBot) DoTurn(s *State) os.Error {
+	hills := hillSquares(true)
+	if len(hills) == 0 {
+		return bot.hunter.DoTurn(s)
+	}
+
+	home := stepsFrom(s, hills, 0)
+	near := stepsFrom(s, hills, TurtleRange)
+	intruders := stepsFrom(s, withinSteps(enemyAntSquares(s), near), 0)
+	food := stepsFrom(s, withinSteps(foodSquares(), near), 0)
+	for _, ant := range sampleAnts(s) {
+		if stepDown(s, ant, intruders) || stepDown(s, ant, food) {
+			continue
+		}
+
+		// chasing an intruder may have taken it out of range
+		if near[ant.square.location] < 0 {
+			stepDown(s, ant, home)
+		} else {
+			wander(s, ant, near)
+		}
+	}
+	return nil
+}
+
+type HoldHillsBot struct{}
+
+func NewHoldHillsBot(s *State, config *Config) Bot {
+	s.Config = config
+	return new(HoldHillsBot)
+}
+
+// Guard posts are the corners of a hill, which leaves its sides free for
+// new ants to leave by
+var holdHillsPosts = []*Offset{&Offset{-1, -1}, &Offset{-1, 1}, &Offset{1, -1}, &Offset{1, 1}}
+
+func (bot *HoldHillsBot) DoTurn(s *State) os.Error {
+	ants := sampleAnts(s)
+
+	// keep at most half our ants on guard, so that some are always out
+	// gathering food; ants already on a post stay there
+	wanted := len(ants) / 2
+	open := make([]*Square, 0)
+	guards := make(map[*Ant]bool)
+	for _, hill := range hillSquares(true) {
+		for _, offset := range holdHillsPosts {
+			post := s.SquareAtLocation(AddOffsetToLocation(s, offset, hill.location))
+			if post.IsWater() {
+				continue
+			}
+			if post.ant == nil {
+				open = append(open, post)
+			} else if len(guards) < wanted {
+				guards[post.ant] = true
+			}
+		}
+	}
+
+	// the ants nearest the open posts go to fill them
+	posts := stepsFrom(s, open, 0)
+	free := make(sampleAntList, 0, len(ants))
+	for _, ant := range ants {
+		if !guards[ant] {
+			free = append(free, &sampleAnt{ant, posts[ant.square.location]})
+		}
+	}
+	sort.Sort(free)
+
+	raze := stepsFrom(s, hillSquares(false), 0)
+	food := stepsFrom(s, foodSquares(), 0)
+	fog := stepsFrom(s, fogSquares(s), 0)
+	for i, candidate := range free {
+		if i < len(open) && i < wanted-len(guards) && stepDown(s, candidate.ant, posts) {
+			continue
+		}
+		seek(s, candidate.ant, raze, food, fog)
+	}
+	return nil
+}
+
+// sampleAnts are our ants in id order, so a sample bot plays the same
+// way every time it sees the same game
+func sampleAnts(s *State) []*Ant {
+	ids := make([]int, 0, len(s.LivingAnts))
+	for id := range s.LivingAnts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	ants := make([]*Ant, len(ids))
+	for i, id := range ids {
+		ants[i] = s.LivingAnts[id]
+	}
+	return ants
+}
+
+// sampleAnt is an ant and how far it is from somewhere, for sorting
+type sampleAnt struct {
+	ant   *Ant
+	steps int // -1 for unreachable
+}
+
+type sampleAntList []*sampleAnt
+
+func (list sampleAntList) Len() int      { return len(list) }
+func (list sampleAntList) Swap(i, j int) { list[i], list[j] = list[j], list[i] }
+func (list sampleAntList) Less(i, j int) bool {
+	if (list[i].steps < 0) != (list[j].steps < 0) {
+		return list[j].steps < 0
+	}
+	if list[i].steps != list[j].steps {
+		return list[i].steps < list[j].steps
+	}
+	return list[i].ant.id < list[j].ant.id
+}
+
+// stepsFrom is how many steps each square is from the nearest of
+// sources, going around known water, or -1 if it's further than limit
+// (when limit isn't 0) or can't be reached. It's indexed by Location.
+func stepsFrom(s *State, sources []*Square, limit int) []int {
+	steps := make([]int, len(s.Grid))
+	for i := range steps {
+		steps[i] = -1
+	}
+
+	queue := make([]*Square, 0, len(sources))
+	for _, source := range sources {
+		if steps[source.location] < 0 {
+			steps[source.location] = 0
+			queue = append(queue, source)
+		}
+	}
+
+	for len(queue) > 0 {
+		square := queue[0]
+		queue = queue[1:]
+		if limit > 0 && steps[square.location] >= limit {
+			continue
+		}
+
+		for _, neighbor := range square.adjacent {
+			if neighbor.IsWater() || steps[neighbor.location] >= 0 {
+				continue
+			}
+			steps[neighbor.location] = steps[square.location] + 1
+			queue = append(queue, neighbor)
+		}
+	}
+
+	return steps
+}
+
+// seek moves ant down the first of fields that takes it nearer to
+// something, or failing that wanders
+func seek(s *State, ant *Ant, fields ...[]int) {
+	for _, steps := range fields {
+		if stepDown(s, ant, steps) {
+			return
+		}
+	}
+	wander(s, ant, nil)
+}
+
+// stepDown orders ant to the free neighbour nearest the sources of
+// steps, if that's nearer than where it is now
+func stepDown(s *State, ant *Ant, steps []int) bool {
+	here := steps[ant.square.location]
+	blacklist := ant.square.Blacklist()
+
+	var best *Square = nil
+	for _, neighbor := range ant.square.adjacent {
+		there := steps[neighbor.location]
+		if neighbor.IsWater() || blacklist.Member(neighbor) || there < 0 || (here >= 0 && there >= here) {
+			continue
+		}
+		if best == nil || there < steps[best.location] {
+			best = neighbor
+		}
+	}
+
+	if best == nil {
+		return false
+	}
+	ant.OrderTo(s, best)
+	return true
+}
+
+// wander orders ant to a random free neighbour, keeping to the squares
+// within reach in steps unless that's nil
+func wander(s *State, ant *Ant, steps []int) bool {
+	blacklist := ant.square.Blacklist()
+	choices := make([]*Square, 0, len(ant.square.adjacent))
+	for _, neighbor := range ant.square.adjacent {
+		if neighbor.IsWater() || blacklist.Member(neighbor) || (steps != nil && steps[neighbor.location] < 0) {
+			continue
+		}
+		choices = append(choices, neighbor)
+	}
+
+	if len(choices) == 0 {
+		return false
+	}
+	ant.OrderTo(s, choices[s.Random.Intn(len(choices))])
+	return true
+}
+
+// withinSteps are the squares that steps reaches
+func withinSteps(squares []*Square, steps []int) []*Square {
+	within := make([]*Square, 0, len(squares))
+	for _, square := range squares {
+		if steps[square.location] >= 0 {
+			within = append(within, square)
+		}
+	}
+	return within
+}
+
+func foodSquares() []*Square {
+	squares := make([]*Square, 0)
+	for _, food := range AllFood() {
+		if food.Exists() {
+			squares = append(squares, food.square)
+		}
+	}
+	return squares
+}
+
+// hillSquares are the hills we know of that are ours, or our enemies'
+func hillSquares(mine bool) []*Square {
+	squares := make([]*Square, 0)
+	for square, item := range AllItems {
+		if item.ItemType() == HillType && item.Exists() && item.IsMine() == mine {
+			squares = append(squares, square)
+		}
+	}
+	return squares
+}
+
+func enemyAntSquares(s *State) []*Square {
+	squares := make([]*Square, len(s.EnemyAnts))
+	for i, sighting := range s.EnemyAnts {
+		squares[i] = sighting.Square
+	}
+	return squares
+}
+
+// fogSquares are the squares not in view, which is where there's
+// something new to see
+func fogSquares(s *State) []*Square {
+	squares := make([]*Square, 0)
+	for i := range s.Grid {
+		square := &s.Grid[i]
+		if !square.IsWater() && !s.Visibility.IsVisible(square) {
+			squares = append(squares, square)
+		}
+	}
+	return squares
+}
@@ -4,31 +4,38 @@ import (
 	"fmt"
 )
 
-type Route []*Square
-
 type SearchNode struct {
-	square *Square
-	goal   Goal
-	route  Route
-	next   *SearchNode
+	goal  Goal
+	route *Route
+	next  *SearchNode
+	turn  int // the queue's turn when the node was pushed
 }
 
-func NewSearchNode(square *Square, goal Goal, route Route) *SearchNode {
-	return &SearchNode{square, goal, route, nil}
+func NewSearchNode(goal Goal, route *Route) *SearchNode {
+	return &SearchNode{goal, route, nil, 0}
 }
 
 func (sn *SearchNode) String() string {
-	return fmt.Sprintf("[Search for a path to %v at %v with existing route %v]", sn.goal, sn.square, sn.route)
+	return fmt.Sprintf("[Search for a path to %v along route %v]", sn.goal, sn.route)
 }
 
 type SearchQueue struct {
 	buckets    []*SearchNode
 	nextBucket int
 	length     int
+	turn       int
+	Deferred   int // nodes popped this turn that were pushed on an earlier one
 }
 
 func NewSearchQueue() *SearchQueue {
-	return &SearchQueue{make([]*SearchNode, 0), 0, 0}
+	return &SearchQueue{make([]*SearchNode, 0), 0, 0, 0, 0}
+}
+
+// NextTurn starts counting Deferred afresh; whatever is still queued
+// now was deferred from an earlier turn
+func (q *SearchQueue) NextTurn() {
+	q.turn++
+	q.Deferred = 0
 }
 
 func (q *SearchQueue) Len() int {
@@ -36,13 +43,15 @@ func (q *SearchQueue) Len() int {
 }
 
 func (q *SearchQueue) Push(node *SearchNode) {
-	bucket := len(node.route)
+	bucket := node.route.Len()
 
 	// make sure the queue is large enough
 	for len(q.buckets) <= bucket {
 		q.buckets = append(q.buckets, nil)
 	}
 
+	node.turn = q.turn
+
 	// put the node in the right bucket at the head (more efficient that way)
 	newNext := q.buckets[bucket]
 	q.buckets[bucket] = node
@@ -69,6 +78,10 @@ func (q *SearchQueue) Pop() *SearchNode {
 	// shift the list in the bucket
 	q.buckets[q.nextBucket] = node.next
 
+	if node.turn < q.turn {
+		q.Deferred++
+	}
+
 	q.length--
 	return node
 }
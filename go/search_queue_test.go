@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSearchQueueDeferred(t *testing.T) {
+	s := textState("...")
+	queue := NewSearchQueue()
+	push := func(col int) {
+		queue.Push(NewSearchNode(nil, NewRoute(s.SquareAtRowCol(0, col), nil)))
+	}
+
+	push(0)
+	push(1)
+	queue.NextTurn()
+	push(2)
+
+	// the newest node of the nearest bucket comes out first
+	for i, deferred := range []int{0, 1, 2} {
+		queue.Pop()
+		if queue.Deferred != deferred {
+			t.Errorf("after %v pops, %v deferred nodes, want %v", i+1, queue.Deferred, deferred)
+		}
+	}
+
+	queue.NextTurn()
+	if queue.Deferred != 0 {
+		t.Errorf("%v deferred nodes at the start of a turn", queue.Deferred)
+	}
+}
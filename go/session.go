@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A Session is one game's connection to the engine. Normally that's our
+// stdin and stdout, but anything that speaks the protocol will do: a
+// recording, an engine running in the same process, a network socket.
+type Session struct {
+	in   *bufio.Reader
+	out  io.Writer
+	Line int // number of lines read so far
+}
+
+func NewSession(in io.Reader, out io.Writer) *Session {
+	return &Session{bufio.NewReader(in), out, 0}
+}
+
+func NewStdioSession() *Session {
+	return NewSession(os.Stdin, os.Stdout)
+}
+
+// ReadLine returns the next line from the engine without its delimiter,
+// which may be "\n" or "\r\n". A last line with no delimiter at all is
+// still returned; os.EOF only comes once there's nothing left.
+func (session *Session) ReadLine() (string, os.Error) {
+	line, err := session.in.ReadString('\n')
+	if err != nil && !(err == os.EOF && line != "") {
+		return "", err
+	}
+
+	session.Line++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (session *Session) IssueOrder(row, col int, d Direction) {
+	fmt.Fprintf(session.out, "o %d %d %s\n", row, col, d)
+}
+
+// Go tells the engine we're ready, or done with this turn
+func (session *Session) Go() {
+	session.out.Write([]byte("go\n"))
+}
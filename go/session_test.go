@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// sessionGame is a short game: our ant spawns on our hill with food three
+// squares south, and walks down to it
+const sessionGame = "turn 0\nloadtime 3000\nturntime 1000\nrows 20\ncols 20\nturns 10\n" +
+	"viewradius2 55\nattackradius2 5\nspawnradius2 1\nplayer_seed 42\nready\n" +
+	"turn 1\nw 3 3\nw 3 4\nf 8 5\nh 5 5 0\na 5 5 0\ngo\n" +
+	"turn 2\nf 8 5\nh 5 5 0\na 6 5 0\ngo\n" +
+	"end\nplayers 2\nscore 1 0\ngo\n"
+
+// southBot orders every ant one step south, every turn
+type southBot struct{}
+
+func (bot *southBot) DoTurn(s *State) os.Error {
+	for _, ant := range s.LivingAnts {
+		ant.OrderTo(s, ant.square.Adjacent(South))
+	}
+	return nil
+}
+
+func newSouthBot(s *State) Bot {
+	return new(southBot)
+}
+
+// playSession plays input as the bot newBot makes, and returns what the
+// bot said to the engine
+func playSession(t *testing.T, newBot func(s *State) Bot, input string) string {
+	var s State
+	var out bytes.Buffer
+	err := s.Start(NewSession(strings.NewReader(input), &out))
+	if err == nil {
+		err = s.Loop(newBot(&s), func() {})
+	}
+	if err != nil && err != os.EOF {
+		t.Fatalf("%v", err)
+	}
+	return out.String()
+}
+
+func newMyBot(s *State) Bot {
+	return NewBot(s, DefaultConfig())
+}
+
+func TestSessionOrders(t *testing.T) {
+	// ready, then one order a turn
+	expected := "go\no 5 5 s\ngo\no 6 5 s\ngo\n"
+	if out := playSession(t, newSouthBot, sessionGame); out != expected {
+		t.Errorf("sent\n%v\nexpected\n%v", out, expected)
+	}
+}
+
+func TestSessionCRLF(t *testing.T) {
+	lf := playSession(t, newSouthBot, sessionGame)
+	crlf := playSession(t, newSouthBot, strings.Replace(sessionGame, "\n", "\r\n", -1))
+	if crlf != lf {
+		t.Errorf("with CRLF lines sent\n%v\nexpected\n%v", crlf, lf)
+	}
+}
+
+// MyBot's moves aren't pinned down here, only that it answers every turn
+// and orders nothing but the ant we have
+func TestSessionMyBot(t *testing.T) {
+	lines := strings.Split(strings.TrimRight(playSession(t, newMyBot, sessionGame), "\n"), "\n")
+	turns := 0
+	for _, line := range lines {
+		switch {
+		case line == "go":
+			turns++
+		case strings.HasPrefix(line, "o 5 5 ") && turns == 1, strings.HasPrefix(line, "o 6 5 ") && turns == 2:
+		default:
+			t.Errorf("unexpected %q after %v turns", line, turns-1)
+		}
+	}
+	if turns != 3 {
+		t.Errorf("sent %v gos, expected 3:\n%v", turns, lines)
+	}
+}
@@ -0,0 +1,470 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"json"
+	"os"
+	"path"
+	"sort"
+)
+
+// Bump when the format changes in a way old snapshots can't be read
+const SnapshotVersion = 1
+
+// A Snapshot is everything the bot believes at the end of a turn, in a
+// form that can be saved as JSON and loaded back into a State. Lists are
+// sorted (by id, or by square) so that the same beliefs always give the
+// same file.
+//
+// Terrain is one string per row:
+//
+//   ?  unknown
+//   %  water we've been told about but not looked at
+//   #  water we've looked at
+//   .  land
+//   ,  land one of our ants has stood on
+//
+// EnemyAnts and Fields are there for looking at, and aren't loaded back:
+// enemy ants are only known for the turn they're seen, and the distance
+// fields recompute themselves.
+type Snapshot struct {
+	Version       int
+	Turn          int
+	Rows          int
+	Cols          int
+	LoadTime      int64
+	TurnTime      int64
+	Turns         int
+	ViewRadius2   int
+	AttackRadius2 int
+	SpawnRadius2  int
+	PlayerSeed    int64
+
+	Terrain     []string
+	Items       []*ItemSnapshot
+	Ants        []*AntSnapshot
+	Goals       []*GoalSnapshot
+	NextAntId   int
+	NextGoalId  GoalId
+	SearchQueue int // nodes left in the distance fields' queue
+
+	EnemyAnts []*EnemyAntSnapshot
+	Fields    []*FieldSnapshot
+}
+
+type SquareSnapshot struct {
+	Row int
+	Col int
+}
+
+type ItemSnapshot struct {
+	Row      int
+	Col      int
+	Type     string // "food" or "hill"
+	Owner    int    // hills only
+	LastSeen int
+}
+
+type AntSnapshot struct {
+	Row   int
+	Col   int
+	Id    int
+	Goal  GoalId            // -1 for none
+	Route []*SquareSnapshot // where the goal's field says to go, if we have fields
+}
+
+type EnemyAntSnapshot struct {
+	Row   int
+	Col   int
+	Owner int
+}
+
+// FieldSnapshot is where one distance field leads: a string per row,
+// with the direction (n, e, s or w) of the next step towards a target,
+// '*' on a target, and '.' where the field hasn't reached
+type FieldSnapshot struct {
+	Type  string
+	Steps []string
+}
+
+type GoalSnapshot struct {
+	Row        int // of the destination
+	Col        int
+	Id         GoalId
+	Type       string          // "eat", "explore" or "raze"
+	Target     *SquareSnapshot // the food for eat, the hill for raze if we've seen it
+	Confidence float64         // raze only
+	Priority   float64
+	Ants       []int
+}
+
+var goalTypeNames = map[GoalType]string{
+	EatType:     "eat",
+	ExploreType: "explore",
+	RazeType:    "raze",
+}
+
+func (state *State) squareSnapshot(square *Square) *SquareSnapshot {
+	return &SquareSnapshot{square.location.Row(state), square.location.Col(state)}
+}
+
+func (state *State) snapshotSquare(row, col int) (*Square, os.Error) {
+	if row < 0 || row >= state.Rows || col < 0 || col >= state.Cols {
+		return nil, os.NewError(fmt.Sprintf("snapshot: square %v,%v is off the map", row, col))
+	}
+	return state.SquareAtRowCol(row, col), nil
+}
+
+// Snapshot captures what we believe right now
+func (state *State) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Version:       SnapshotVersion,
+		Turn:          state.Turn,
+		Rows:          state.Rows,
+		Cols:          state.Cols,
+		LoadTime:      state.LoadTime,
+		TurnTime:      state.TurnTime,
+		Turns:         state.Turns,
+		ViewRadius2:   state.ViewRadius2,
+		AttackRadius2: state.AttackRadius2,
+		SpawnRadius2:  state.SpawnRadius2,
+		PlayerSeed:    state.PlayerSeed,
+		Items:         make([]*ItemSnapshot, 0),
+		Ants:          make([]*AntSnapshot, 0),
+		Goals:         make([]*GoalSnapshot, 0),
+		EnemyAnts:     make([]*EnemyAntSnapshot, 0),
+		Fields:        make([]*FieldSnapshot, 0),
+		NextAntId:     state.NextAntId,
+		NextGoalId:    nextGoalId,
+	}
+
+	snapshot.Terrain = make([]string, state.Rows)
+	row := make([]byte, state.Cols)
+	for r := 0; r < state.Rows; r++ {
+		for c := 0; c < state.Cols; c++ {
+			row[c] = state.SquareAtRowCol(r, c).snapshotSymbol()
+		}
+		snapshot.Terrain[r] = string(row)
+	}
+
+	for square, item := range AllItems {
+		itemSnapshot := &ItemSnapshot{Row: square.location.Row(state), Col: square.location.Col(state), LastSeen: state.Turn - item.TimeSinceLastSeen()}
+		switch item.ItemType() {
+		case FoodType:
+			itemSnapshot.Type = "food"
+		case HillType:
+			itemSnapshot.Type = "hill"
+			itemSnapshot.Owner = item.(*Hill).owner
+		default:
+			continue
+		}
+		snapshot.Items = append(snapshot.Items, itemSnapshot)
+	}
+	sort.Sort(itemSnapshotList(snapshot.Items))
+
+	for _, ant := range state.LivingAnts {
+		antSnapshot := &AntSnapshot{Row: ant.square.location.Row(state), Col: ant.square.location.Col(state), Id: ant.id, Goal: -1}
+		if ant.goal != nil {
+			antSnapshot.Goal = ant.goal.Id()
+			if state.Fields != nil {
+				for route := ant.Route(); route != nil; route = route.Next() {
+					antSnapshot.Route = append(antSnapshot.Route, state.squareSnapshot(route.Square()))
+				}
+			}
+		}
+		snapshot.Ants = append(snapshot.Ants, antSnapshot)
+	}
+	sort.Sort(antSnapshotList(snapshot.Ants))
+
+	for _, goal := range AllGoals {
+		snapshot.Goals = append(snapshot.Goals, state.goalSnapshot(goal))
+	}
+	sort.Sort(goalSnapshotList(snapshot.Goals))
+
+	for _, sighting := range state.EnemyAnts {
+		location := sighting.Square.location
+		snapshot.EnemyAnts = append(snapshot.EnemyAnts, &EnemyAntSnapshot{location.Row(state), location.Col(state), sighting.Owner})
+	}
+
+	for _, goalType := range []GoalType{EatType, ExploreType, RazeType} {
+		field, ok := state.Fields[goalType]
+		if !ok {
+			continue
+		}
+
+		// every field shares the one queue
+		snapshot.SearchQueue = field.queue.Len()
+		snapshot.Fields = append(snapshot.Fields, state.fieldSnapshot(goalType, field))
+	}
+
+	return snapshot
+}
+
+func (state *State) fieldSnapshot(goalType GoalType, field *DistanceField) *FieldSnapshot {
+	fieldSnapshot := &FieldSnapshot{goalTypeNames[goalType], make([]string, state.Rows)}
+	row := make([]byte, state.Cols)
+	for r := 0; r < state.Rows; r++ {
+		for c := 0; c < state.Cols; c++ {
+			square := state.SquareAtRowCol(r, c)
+			switch next := field.NextStep(square); {
+			case field.Distance(square) == Unreachable:
+				row[c] = '.'
+			case next == nil:
+				row[c] = '*'
+			default:
+				row[c] = square.DirectionTo(state, next).String()[0]
+			}
+		}
+		fieldSnapshot.Steps[r] = string(row)
+	}
+
+	return fieldSnapshot
+}
+
+func (square *Square) snapshotSymbol() byte {
+	switch {
+	case square.terrain == Water && square.observed:
+		return '#'
+	case square.terrain == Water:
+		return '%'
+	case square.terrain == Land && square.visited:
+		return ','
+	case square.terrain == Land:
+		return '.'
+	}
+	return '?'
+}
+
+func (state *State) goalSnapshot(goal Goal) *GoalSnapshot {
+	destination := goal.Destination().location
+	goalSnapshot := &GoalSnapshot{
+		Row:  destination.Row(state),
+		Col:  destination.Col(state),
+		Id:   goal.Id(),
+		Type: goalTypeNames[goal.GoalType()],
+		Ants: make([]int, 0),
+	}
+	if state.Config != nil {
+		goalSnapshot.Priority = goal.Priority()
+	}
+
+	switch g := goal.(type) {
+	case *Eat:
+		goalSnapshot.Target = state.squareSnapshot(g.food.square)
+	case *Raze:
+		if g.hill != nil {
+			goalSnapshot.Target = state.squareSnapshot(g.hill.square)
+		}
+		goalSnapshot.Confidence = g.confidence
+	}
+
+	// goals remember every ant that ever joined them; only list the ones
+	// still pursuing this goal
+	for _, ant := range state.LivingAnts {
+		if ant.goal != nil && ant.goal.Id() == goal.Id() {
+			goalSnapshot.Ants = append(goalSnapshot.Ants, ant.id)
+		}
+	}
+	sort.Ints(goalSnapshot.Ants)
+
+	return goalSnapshot
+}
+
+func (snapshot *Snapshot) Save(filename string) os.Error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// SaveSnapshot writes this turn's snapshot into dir as turn-NNNN.json
+func (state *State) SaveSnapshot(dir string) os.Error {
+	return state.Snapshot().Save(path.Join(dir, fmt.Sprintf("turn-%04d.json", state.Turn)))
+}
+
+func LoadSnapshot(filename string) (*Snapshot, os.Error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := new(Snapshot)
+	err = json.Unmarshal(data, snapshot)
+	if err != nil {
+		return nil, os.NewError(fmt.Sprintf("snapshot %v: %v", filename, err))
+	}
+	if snapshot.Version != SnapshotVersion {
+		return nil, os.NewError(fmt.Sprintf("snapshot %v: version %v, expected %v", filename, snapshot.Version, SnapshotVersion))
+	}
+
+	return snapshot, nil
+}
+
+// NewState rebuilds the beliefs in the snapshot, replacing any other
+// game's goals and items. The state has the default config and a fresh
+// map analysis, so its goals can be checked and generated, but no bot
+// yet: NewBot gives it distance fields (which pick up the goals on the
+// next turn) and its own config. Routes and the search queue aren't
+// restored, since the fields recompute them.
+func (snapshot *Snapshot) NewState() (*State, os.Error) {
+	if snapshot.Rows <= 0 || snapshot.Cols <= 0 || len(snapshot.Terrain) != snapshot.Rows {
+		return nil, os.NewError(fmt.Sprintf("snapshot: map size %vx%v doesn't match the terrain", snapshot.Rows, snapshot.Cols))
+	}
+
+	s := &State{
+		LoadTime:      snapshot.LoadTime,
+		TurnTime:      snapshot.TurnTime,
+		Rows:          snapshot.Rows,
+		Cols:          snapshot.Cols,
+		Turns:         snapshot.Turns,
+		ViewRadius2:   snapshot.ViewRadius2,
+		AttackRadius2: snapshot.AttackRadius2,
+		SpawnRadius2:  snapshot.SpawnRadius2,
+		Turn:          snapshot.Turn,
+		PlayerSeed:    snapshot.PlayerSeed,
+		Params:        make(map[string]string),
+		Config:        DefaultConfig(),
+	}
+	s.Init()
+	s.Analysis = NewMapAnalysis(s)
+
+	for row, line := range snapshot.Terrain {
+		if len(line) != s.Cols {
+			return nil, os.NewError(fmt.Sprintf("snapshot: terrain row %v has %v squares, expected %v", row, len(line), s.Cols))
+		}
+
+		for col, symbol := range []byte(line) {
+			square := s.SquareAtRowCol(row, col)
+			switch symbol {
+			case '?':
+			case '%':
+				square.terrain = Water
+			case '#':
+				square.terrain = Water
+				square.observed = true
+			case ',':
+				square.Observe(s)
+				square.visited = true
+			case '.':
+				square.Observe(s)
+			default:
+				return nil, os.NewError(fmt.Sprintf("snapshot: invalid terrain %q at %v,%v", symbol, row, col))
+			}
+		}
+	}
+
+	for _, itemSnapshot := range snapshot.Items {
+		square, err := s.snapshotSquare(itemSnapshot.Row, itemSnapshot.Col)
+		if err != nil {
+			return nil, err
+		}
+
+		switch itemSnapshot.Type {
+		case "food":
+			s.NewFood(square).lastSeen = itemSnapshot.LastSeen
+		case "hill":
+			s.NewHill(itemSnapshot.Owner, square).lastSeen = itemSnapshot.LastSeen
+		default:
+			return nil, os.NewError(fmt.Sprintf("snapshot: unknown item type %q", itemSnapshot.Type))
+		}
+	}
+
+	for _, goalSnapshot := range snapshot.Goals {
+		err := s.restoreGoal(goalSnapshot)
+		if err != nil {
+			return nil, err
+		}
+	}
+	nextGoalId = snapshot.NextGoalId
+
+	for _, antSnapshot := range snapshot.Ants {
+		square, err := s.snapshotSquare(antSnapshot.Row, antSnapshot.Col)
+		if err != nil {
+			return nil, err
+		}
+
+		s.NextAntId = antSnapshot.Id
+		ant := s.NewAnt(square)
+		if antSnapshot.Goal >= 0 {
+			goal, ok := AllGoals[antSnapshot.Goal]
+			if !ok {
+				return nil, os.NewError(fmt.Sprintf("snapshot: ant %v has unknown goal %v", ant.id, antSnapshot.Goal))
+			}
+			ant.SetGoal(goal)
+		}
+	}
+	s.NextAntId = snapshot.NextAntId
+
+	return s, nil
+}
+
+// restoreGoal makes the goal under its old id, and puts it back in the
+// index that stops it being generated again
+func (s *State) restoreGoal(goalSnapshot *GoalSnapshot) os.Error {
+	destination, err := s.snapshotSquare(goalSnapshot.Row, goalSnapshot.Col)
+	if err != nil {
+		return err
+	}
+
+	var target *Square
+	if goalSnapshot.Target != nil {
+		target, err = s.snapshotSquare(goalSnapshot.Target.Row, goalSnapshot.Target.Col)
+		if err != nil {
+			return err
+		}
+	}
+
+	nextGoalId = goalSnapshot.Id
+	switch goalSnapshot.Type {
+	case "eat":
+		if target == nil || !target.HasFood() {
+			return os.NewError(fmt.Sprintf("snapshot: eat goal %v has no food", goalSnapshot.Id))
+		}
+		food := target.item.(*Food)
+		if EatIndex[destination] == nil {
+			EatIndex[destination] = make(map[*Food]*Eat)
+		}
+		EatIndex[destination][food] = NewEat(destination, food)
+
+	case "explore":
+		ExploreIndex[destination] = NewExplore(destination)
+
+	case "raze":
+		var hill *Hill
+		if target != nil {
+			if !target.HasHill() {
+				return os.NewError(fmt.Sprintf("snapshot: raze goal %v has no hill", goalSnapshot.Id))
+			}
+			hill = target.item.(*Hill)
+		}
+		RazeIndex[destination] = NewRaze(destination, hill, goalSnapshot.Confidence)
+
+	default:
+		return os.NewError(fmt.Sprintf("snapshot: unknown goal type %q", goalSnapshot.Type))
+	}
+
+	return nil
+}
+
+type itemSnapshotList []*ItemSnapshot
+
+func (list itemSnapshotList) Len() int      { return len(list) }
+func (list itemSnapshotList) Swap(i, j int) { list[i], list[j] = list[j], list[i] }
+func (list itemSnapshotList) Less(i, j int) bool {
+	return list[i].Row < list[j].Row || (list[i].Row == list[j].Row && list[i].Col < list[j].Col)
+}
+
+type antSnapshotList []*AntSnapshot
+
+func (list antSnapshotList) Len() int           { return len(list) }
+func (list antSnapshotList) Swap(i, j int)      { list[i], list[j] = list[j], list[i] }
+func (list antSnapshotList) Less(i, j int) bool { return list[i].Id < list[j].Id }
+
+type goalSnapshotList []*GoalSnapshot
+
+func (list goalSnapshotList) Len() int           { return len(list) }
+func (list goalSnapshotList) Swap(i, j int)      { list[i], list[j] = list[j], list[i] }
+func (list goalSnapshotList) Less(i, j int) bool { return list[i].Id < list[j].Id }
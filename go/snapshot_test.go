@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"json"
+	"strings"
+	"testing"
+)
+
+// playSnapshots plays the game in filename as MyBot, and returns the
+// snapshot at the end of each turn
+func playSnapshots(t *testing.T, filename string) []*Snapshot {
+	input, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	snapshots := make([]*Snapshot, 0)
+	var out bytes.Buffer
+	err = PlayAndWatch(NewSession(bytes.NewBuffer(input), &out), DefaultConfig(), func(s *State) {
+		snapshots = append(snapshots, s.Snapshot())
+	})
+	if err != nil {
+		t.Fatalf("%v: %v", filename, err)
+	}
+	return snapshots
+}
+
+// snapshotJSON is the parts of snapshot that NewState restores, as JSON
+func snapshotJSON(t *testing.T, snapshot *Snapshot) []byte {
+	restorable := *snapshot
+	restorable.EnemyAnts, restorable.Fields, restorable.SearchQueue = nil, nil, 0
+	restorable.Ants = make([]*AntSnapshot, len(snapshot.Ants))
+	for i, ant := range snapshot.Ants {
+		withoutRoute := *ant
+		withoutRoute.Route = nil
+		restorable.Ants[i] = &withoutRoute
+	}
+
+	data, err := json.MarshalIndent(&restorable, "", " ")
+	if err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	return data
+}
+
+// TestSnapshotRoundTrip saves each turn of a game with an enemy hill in
+// it, loads it back, and snapshots that, which should give the same
+// beliefs. The restored goals (raze goals especially) must work without a
+// bot.
+func TestSnapshotRoundTrip(t *testing.T) {
+	razes := 0
+	for _, snapshot := range playSnapshots(t, "testdata/protocol/game.txt") {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		loaded := new(Snapshot)
+		if err := json.Unmarshal(data, loaded); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+
+		s, err := loaded.NewState()
+		if err != nil {
+			t.Fatalf("turn %v: NewState: %v", snapshot.Turn, err)
+		}
+		for _, goal := range AllGoals {
+			goal.IsValid()
+			goal.Priority()
+			if goal.GoalType() == RazeType {
+				razes++
+			}
+		}
+		s.GenerateRaze()
+
+		expected, got := snapshotJSON(t, snapshot), snapshotJSON(t, s.Snapshot())
+		if !bytes.Equal(got, expected) {
+			t.Errorf("turn %v: restored as\n%s\nexpected\n%s", snapshot.Turn, got, expected)
+		}
+	}
+
+	if razes == 0 {
+		t.Errorf("no raze goals restored")
+	}
+}
+
+// TestSnapshotWater checks that water that came into view is drawn as
+// seen, and none of it as merely reported
+func TestSnapshotWater(t *testing.T) {
+	snapshots := playSnapshots(t, "testdata/protocol/game.txt")
+	terrain := strings.Join(snapshots[len(snapshots)-1].Terrain, "\n")
+	if !strings.Contains(terrain, "#") || strings.Contains(terrain, "%") {
+		t.Errorf("terrain at the end is\n%v", terrain)
+	}
+}
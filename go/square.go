@@ -1,38 +1,42 @@
 package main
 
-import (
-	"math"
-)
-
 type Square struct {
-	state               *State
-	location            Location
-	observed            bool
-	visited             bool
-	item                Item
-	goals               map[GoalId]Route
-	ant                 *Ant
-	nextAnt             *Ant
-	neighborsCached     bool
-	neighbors           SquareSet
-	deferredSearchNodes []*SearchNode
-}
-
+	state           *State
+	location        Location
+	terrain         Terrain
+	observed        bool
+	visited         bool
+	item            Item
+	ant             *Ant
+	nextAnt         *Ant
+	adjacent        [4]*Square // indexed by Direction, water or not
+	neighborsCached bool
+	neighbors       SquareSet
+}
+
+// CreateSquares lays out the map as one dense grid indexed by Location
 func (state *State) CreateSquares() {
-	state.AllSquares = make(SquareSet)
+	state.Grid = make([]Square, state.Rows*state.Cols)
+
+	for i := range state.Grid {
+		square := &state.Grid[i]
+		square.state = state
+		square.location = (Location)(i)
+		square.neighbors = make(SquareSet)
+	}
 
-	for row := 0; row < state.Rows; row++ {
-		for col := 0; col < state.Cols; col++ {
-			loc := NewLocation(state, row, col)
-			square := Square{state: state, location: loc, goals: make(map[GoalId]Route), neighbors: make(SquareSet), deferredSearchNodes: make([]*SearchNode, 0)}
-			state.AllSquares.Add(&square)
+	for i := range state.Grid {
+		for direction, offset := range Directions {
+			location := AddOffsetToLocation(state, offset, (Location)(i))
+			state.Grid[i].adjacent[direction] = &state.Grid[location]
 		}
 	}
+
+	state.ObservedSquares = NewSquareBits(state)
 }
 
 func (state *State) SquareAtLocation(loc Location) *Square {
-	square := state.AllSquares[loc]
-	return square
+	return &state.Grid[loc]
 }
 
 func (state *State) SquareAtRowCol(row int, col int) *Square {
@@ -41,9 +45,9 @@ func (state *State) SquareAtRowCol(row int, col int) *Square {
 }
 
 func (state *State) ResetAntsOnSquares() {
-	for _, square := range state.AllSquares {
-		square.nextAnt = nil
-		square.ant = nil
+	for i := range state.Grid {
+		state.Grid[i].nextAnt = nil
+		state.Grid[i].ant = nil
 	}
 }
 
@@ -64,16 +68,20 @@ func (square *Square) String() string {
 }
 
 func (square *Square) DirectionTo(state *State, adjacent *Square) Direction {
-	for direction, offset := range Directions {
-		directionLoc := AddOffsetToLocation(state, offset, square.location)
-		if directionLoc == adjacent.location {
-			return direction
+	for direction, neighbor := range square.adjacent {
+		if neighbor == adjacent {
+			return (Direction)(direction)
 		}
 	}
 
 	panic("Square is not adjacent!")
 }
 
+// Adjacent is the square one step away in direction, even if it's water
+func (square *Square) Adjacent(direction Direction) *Square {
+	return square.adjacent[direction]
+}
+
 func Abs(i int) int {
 	if i < 0 {
 		return -1 * i
@@ -98,56 +106,18 @@ func Distance2(state *State, r1, c1, r2, c2 int) int {
 	return dr*dr + dc*dc
 }
 
-func (square *Square) Visit(state *State) int {
-	if square.visited {
-		return 0
-	}
-
-	square.visited = true
-
-	observedCount := 0
-	for _, vis := range *square.VisibleSquares(state) {
-		if !vis.observed {
-			vis.Observe(state)
-			observedCount++
-		}
-	}
-
-	return observedCount
-}
-
-var visibilityMask []*Offset = make([]*Offset, 0)
-
-func (square *Square) VisibleSquares(state *State) *SquareSet {
-	// build the visiblity mask if it's never been initialized before
-	if len(visibilityMask) == 0 {
-		viewRadius := (int)(math.Ceil(math.Sqrt((float64)(state.ViewRadius2))))
-		for rowOffset := -1 * viewRadius; rowOffset <= viewRadius; rowOffset++ {
-			for colOffset := -1 * viewRadius; colOffset <= viewRadius; colOffset++ {
-				if Distance2(state, 0, 0, rowOffset, colOffset) < state.ViewRadius2 {
-					visibilityMask = append(visibilityMask, &Offset{rowOffset, colOffset})
-				}
-			}
-		}
+func (square *Square) Observe(state *State) {
+	square.observed = true
+	if square.terrain == Unknown {
+		square.terrain = Land
 	}
-
-	// apply the visibility mask to this square
-	// TODO memoize result?
-	visible := make(SquareSet)
-	for _, offset := range visibilityMask {
-		otherLocation := AddOffsetToLocation(state, offset, square.location)
-		otherSquare, ok := state.AllSquares[otherLocation]
-		if ok {
-			visible.Add(otherSquare)
-		}
+	if square.terrain == Land {
+		state.ObservedSquares.Add(square)
 	}
-
-	return &visible
 }
 
-func (square *Square) Observe(state *State) {
-	state.ObservedSquares.Add(square)
-	square.observed = true
+func (square *Square) IsWater() bool {
+	return square.terrain == Water
 }
 
 func (square *Square) HasFood() bool {
@@ -162,19 +132,11 @@ func (square *Square) HasEnemyAnt() bool {
 	return (square.item != nil) && (square.item.ItemType() == EnemyAntType)
 }
 
-func (square *Square) HasGoal(goal Goal) bool {
-	_, ok := square.goals[goal.Id()]
-	return ok
-}
-
+// Neighbors are the adjacent squares that aren't known to be water
 func (square *Square) Neighbors() SquareSet {
 	if !square.neighborsCached {
-		// TODO factor out this list of offsets, I have it elsewhere
-		offsets := [4]*Offset{&Offset{-1, 0}, &Offset{1, 0}, &Offset{0, -1}, &Offset{0, 1}}
-		for _, offset := range offsets {
-			location := AddOffsetToLocation(square.state, offset, square.location)
-			neighbor := square.state.SquareAtLocation(location)
-			if neighbor != nil {
+		for _, neighbor := range square.adjacent {
+			if !neighbor.IsWater() {
 				square.neighbors.Add(neighbor)
 			}
 		}
@@ -197,12 +159,23 @@ func (square *Square) Blacklist() SquareSet {
 }
 
 func (square *Square) Destroy() {
+	if square.IsWater() {
+		return
+	}
+
 	for _, neighbor := range square.Neighbors() {
 		neighbor.RemoveDeadNeighbor(square)
 	}
 
-	square.state.AllSquares.Remove(square)
-	// TODO remove from observed once we restore that index
+	square.terrain = Water
+	square.state.ObservedSquares.Remove(square)
+
+	for _, field := range square.state.Fields {
+		field.Remove(square)
+	}
+	for _, search := range square.state.Searches {
+		search.SquareChanged(square)
+	}
 }
 
 func (square *Square) RemoveDeadNeighbor(neighbor *Square) {
@@ -211,13 +184,14 @@ func (square *Square) RemoveDeadNeighbor(neighbor *Square) {
 	}
 }
 
+// IsFrontier is true for known land next to squares we know nothing about
 func (square *Square) IsFrontier() bool {
-	if !square.observed {
+	if square.terrain != Land {
 		return false
 	}
 
-	for _, neighbor := range square.Neighbors() {
-		if !neighbor.observed {
+	for _, neighbor := range square.adjacent {
+		if neighbor.terrain == Unknown {
 			return true
 		}
 	}
@@ -0,0 +1,62 @@
+package main
+
+// SquareBits is a set of squares packed one bit per Location. It's much
+// cheaper than a SquareSet for sets that can span the whole map; use
+// SquareSet() to hand one to code that expects the map-based API.
+type SquareBits struct {
+	state *State
+	words []uint64
+	count int
+}
+
+func NewSquareBits(state *State) *SquareBits {
+	return &SquareBits{state, make([]uint64, (state.Rows*state.Cols+63)/64), 0}
+}
+
+func (bits *SquareBits) Add(square *Square) {
+	word, mask := square.location/64, uint64(1)<<(uint(square.location)%64)
+	if bits.words[word]&mask == 0 {
+		bits.words[word] |= mask
+		bits.count++
+	}
+}
+
+func (bits *SquareBits) Remove(square *Square) {
+	word, mask := square.location/64, uint64(1)<<(uint(square.location)%64)
+	if bits.words[word]&mask != 0 {
+		bits.words[word] &^= mask
+		bits.count--
+	}
+}
+
+func (bits *SquareBits) Member(square *Square) bool {
+	return bits.words[square.location/64]&(uint64(1)<<(uint(square.location)%64)) != 0
+}
+
+func (bits *SquareBits) Len() int {
+	return bits.count
+}
+
+// Squares lists the members in Location order
+func (bits *SquareBits) Squares() []*Square {
+	squares := make([]*Square, 0, bits.count)
+	for i, word := range bits.words {
+		for bit := 0; word != 0; bit++ {
+			if word&1 != 0 {
+				squares = append(squares, bits.state.SquareAtLocation((Location)(i*64+bit)))
+			}
+			word >>= 1
+		}
+	}
+
+	return squares
+}
+
+func (bits *SquareBits) SquareSet() SquareSet {
+	set := make(SquareSet)
+	for _, square := range bits.Squares() {
+		set.Add(square)
+	}
+
+	return set
+}
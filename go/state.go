@@ -1,5 +1,9 @@
 package main
 
+import (
+	"rand"
+)
+
 //State keeps track of everything we need to know about the state of the game
 type State struct {
 	LoadTime      int64 //in milliseconds
@@ -11,13 +15,61 @@ type State struct {
 	AttackRadius2 int   //battle radius squared
 	SpawnRadius2  int   //spawn radius squared
 	Turn          int   //current turn number
+	PlayerSeed    int64 //seed the engine gave us for our random numbers
+
+	Random *rand.Rand //every random choice we make, seeded from PlayerSeed
+
+	Params  map[string]string //every setup parameter, including any we don't use
+	Session *Session          //connection to the engine
+	Config  *Config           //our own settings, from NewBot
+	Budget  *Budget           //time left this turn
+
+	Telemetry *Telemetry //timings and counters from every turn so far
+
+	EnemyAnts []*AntSighting //enemy ants in view this turn
+	DeadAnts  []*AntSighting //ants (ours included) that died in view last turn
+	Result    *GameResult    //how the game ended, once it has
 
 	NextAntId  int
 	LivingAnts map[int]*Ant
 	Stats      *Stats
 
-	AllSquares      SquareSet
-	ObservedSquares SquareSet
+	Grid            []Square
+	ObservedSquares *SquareBits // observed land, never water
+	Visibility      *Visibility
+
+	Fields   map[GoalType]*DistanceField
+	Searches map[GoalId]*GoalSearch
+	Analysis *MapAnalysis
+}
+
+//AntSighting is an ant the engine told us about this turn
+type AntSighting struct {
+	Square *Square
+	Owner  int
+}
+
+//GameResult is the end of game block the engine sends after "end"
+type GameResult struct {
+	Turn    int   //last turn played
+	Players int   //number of players in the game
+	Scores  []int //indexed by player, we're player 0
+}
+
+//Rank is our place in the final standings, counting from 1; players
+//with the same score share a place. It's 0 if there are no scores.
+func (result *GameResult) Rank() int {
+	if len(result.Scores) == 0 {
+		return 0
+	}
+
+	rank := 1
+	for _, score := range result.Scores {
+		if score > result.Scores[0] {
+			rank++
+		}
+	}
+	return rank
 }
 
 func (s *State) NormalizeRow(row int) int {
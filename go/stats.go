@@ -14,10 +14,15 @@ type Stats struct {
 // TODO new instead of mutate?
 func (stats *Stats) Update(s *State) {
 	totalSpace := (float64)(s.Rows * s.Cols)
-	nonWater, observed, visited, food, enemyAnts, myHills, enemyHills := 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0
+	water, observed, visited, food, enemyAnts, myHills, enemyHills := 0.0, 0.0, 0.0, 0.0, 0.0, 0.0, 0.0
+
+	for i := range s.Grid {
+		square := &s.Grid[i]
+		if square.IsWater() {
+			water++
+			continue
+		}
 
-	for _, square := range s.AllSquares {
-		nonWater++
 		if square.observed {
 			observed++
 		}
@@ -36,19 +41,24 @@ func (stats *Stats) Update(s *State) {
 		if square.HasEnemyAnt() {
 			enemyAnts++
 		}
-		myAnts := (float64)(len(s.LivingAnts))
-
-		// These are rates instead of ratios to avoid low-precision
-		// floats. They're not intuitive - just statistics to be used by the
-		// algorithm
-		stats.water = totalSpace / (totalSpace - nonWater)
-		stats.observed = totalSpace / observed
-		stats.visited = totalSpace / visited
-		stats.food = totalSpace / (food + 1)
-		stats.myAnts = totalSpace / (myAnts + 1)
-		stats.enemyAnts = totalSpace / (enemyAnts + 1)
-		stats.myHills = totalSpace / (myHills + 1)
-		stats.enemyHills = totalSpace / (enemyHills + 1)
-		// TODO add enemy count
 	}
+	myAnts := (float64)(len(s.LivingAnts))
+
+	// These are rates instead of ratios to avoid low-precision
+	// floats. They're not intuitive - just statistics to be used by the
+	// algorithm
+	stats.water = totalSpace / water
+	stats.observed = totalSpace / observed
+	stats.visited = totalSpace / visited
+	stats.food = totalSpace / (food + 1)
+	stats.myAnts = totalSpace / (myAnts + 1)
+	stats.enemyAnts = totalSpace / (enemyAnts + 1)
+	stats.myHills = totalSpace / (myHills + 1)
+	stats.enemyHills = totalSpace / (enemyHills + 1)
+	// TODO add enemy count
+}
+
+// Vector lists the statistics in the order the params matrix expects
+func (stats *Stats) Vector() []float64 {
+	return []float64{stats.water, stats.observed, stats.visited, stats.food, stats.myAnts, stats.enemyAnts, stats.myHills, stats.enemyHills}
 }
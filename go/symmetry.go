@@ -0,0 +1,445 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"rand"
+	"sort"
+)
+
+// Official maps give every player an identical copy of the terrain,
+// related by a symmetry of the torus. MapAnalysis works out which
+// symmetries are consistent with what we've seen so far, and uses them
+// to guess at unobserved terrain and at where the enemy hills are.
+
+// Only symmetries with at least this much confidence are used
+const MinSymmetryConfidence = 0.5
+
+// Pseudo-observations against a symmetry before any evidence is in; the
+// larger this is, the more matching water it takes to be believed
+const SymmetryPrior = 20.0
+
+// Tolerated fraction of known squares that a symmetry gets wrong
+const SymmetryTolerance = 0.02
+
+// How many known squares to check a candidate against
+const SymmetrySamples = 1000
+
+// Until a symmetry fits, re-run inference once this fraction of the map
+// has been newly learned
+const SymmetryRefresh = 0.05
+
+// A Symmetry is an affine map of the torus:
+// (row, col) -> matrix * (row, col) + (rowShift, colShift)
+type Symmetry struct {
+	name       string
+	matrix     [4]int
+	rowShift   int
+	colShift   int
+	Agreements int // known water that maps onto known water
+	Conflicts  int // known squares that map onto the other kind of terrain
+	Confidence float64
+}
+
+type symmetryMatrix struct {
+	name       string
+	matrix     [4]int
+	squareOnly bool // mixes rows and columns, so needs rows == cols
+}
+
+var symmetryMatrices = []symmetryMatrix{
+	symmetryMatrix{"translation", [4]int{1, 0, 0, 1}, false},
+	symmetryMatrix{"rotation 180", [4]int{-1, 0, 0, -1}, false},
+	symmetryMatrix{"mirror rows", [4]int{-1, 0, 0, 1}, false},
+	symmetryMatrix{"mirror cols", [4]int{1, 0, 0, -1}, false},
+	symmetryMatrix{"rotation 90", [4]int{0, 1, -1, 0}, true},
+	symmetryMatrix{"diagonal", [4]int{0, 1, 1, 0}, true},
+	symmetryMatrix{"anti-diagonal", [4]int{0, -1, -1, 0}, true},
+}
+
+func (sym *Symmetry) String() string {
+	return fmt.Sprintf("[%v shifted by (%v, %v), confidence %.2f from %v matches and %v conflicts]",
+		sym.name, sym.rowShift, sym.colShift, sym.Confidence, sym.Agreements, sym.Conflicts)
+}
+
+func (sym *Symmetry) Apply(state *State, square *Square) *Square {
+	row, col := square.location.Row(state), square.location.Col(state)
+	newRow := state.NormalizeRow(sym.matrix[0]*row + sym.matrix[1]*col + sym.rowShift)
+	newCol := state.NormalizeCol(sym.matrix[2]*row + sym.matrix[3]*col + sym.colShift)
+	return state.SquareAtRowCol(newRow, newCol)
+}
+
+type HillPrediction struct {
+	Square     *Square
+	Confidence float64
+}
+
+type MapAnalysis struct {
+	state          *State
+	Symmetries     []*Symmetry // accepted symmetries, most confident first
+	PredictedHills []*HillPrediction
+	predicted      []Terrain
+	confidence     []float64
+	knownAtLast    int           // known squares when we last finished the inference
+	hillsAtLast    int           // enemy hills seen when we last finished it
+	pass           *symmetryPass // an inference that ran out of time, to carry on with
+	random         *rand.Rand
+}
+
+// A symmetryPass is one run of the inference through the candidates,
+// which may take several turns on a big map
+type symmetryPass struct {
+	hill       *Square // the hill of ours whose images are the candidates
+	enemyHills int     // enemy hills seen when the pass began
+	next       int     // the number of the next candidate to check
+	accepted   SymmetryList
+}
+
+func NewMapAnalysis(state *State) *MapAnalysis {
+	size := state.Rows * state.Cols
+	return &MapAnalysis{state, make([]*Symmetry, 0), make([]*HillPrediction, 0), make([]Terrain, size), make([]float64, size), 0, 0, nil, rand.New(rand.NewSource(state.PlayerSeed))}
+}
+
+// PredictTerrain is what we believe is under square, and how sure we are
+func (analysis *MapAnalysis) PredictTerrain(square *Square) (Terrain, float64) {
+	if square.terrain != Unknown {
+		return square.terrain, 1.0
+	}
+
+	return analysis.predicted[square.location], analysis.confidence[square.location]
+}
+
+// LeadsNowhere is whether every unknown square next to square is
+// confidently predicted to be water, so that exploring there shouldn't
+// show us any new land
+func (analysis *MapAnalysis) LeadsNowhere(square *Square) bool {
+	unknown := 0
+	for _, neighbor := range square.adjacent {
+		if neighbor.terrain != Unknown {
+			continue
+		}
+
+		unknown++
+		terrain, confidence := analysis.PredictTerrain(neighbor)
+		if terrain != Water || confidence < MinSymmetryConfidence {
+			return false
+		}
+	}
+
+	return unknown > 0
+}
+
+// HillConfidence is how sure we are there's an enemy hill on square
+func (analysis *MapAnalysis) HillConfidence(square *Square) float64 {
+	for _, prediction := range analysis.PredictedHills {
+		if prediction.Square == square {
+			return prediction.Confidence
+		}
+	}
+
+	return 0.0
+}
+
+// Update re-runs the inference if what we've learned since last time
+// calls for it (see stale). If phase runs out of time, the symmetries
+// accepted so far are used, and the next Update carries on from the
+// candidate it stopped at.
+func (analysis *MapAnalysis) Update(phase *Phase) {
+	known := analysis.knownSquares()
+	enemyHills := len(analysis.enemyHills())
+	myHills := analysis.myHills()
+
+	// a pass is only worth finishing if its candidates are still the
+	// right ones
+	pass := analysis.pass
+	if pass != nil && !(pass.hill.HasHill() && pass.hill.item.IsMine() && pass.enemyHills == enemyHills) {
+		pass = nil
+	}
+	if pass == nil {
+		if !analysis.stale(len(known), enemyHills) || len(myHills) == 0 {
+			analysis.pass = nil
+			return
+		}
+		pass = &symmetryPass{myHills[0], enemyHills, 0, make(SymmetryList, 0)}
+	}
+
+	// check candidates against a fixed random sample of what we know
+	for i := range known {
+		j := i + analysis.random.Intn(len(known)-i)
+		known[i], known[j] = known[j], known[i]
+	}
+	if len(known) > SymmetrySamples {
+		known = known[:SymmetrySamples]
+	}
+
+	checked := 0
+	next, finished := analysis.eachCandidate(pass.hill, pass.next, func(candidate Symmetry) bool {
+		if !phase.Continue() {
+			return false
+		}
+
+		checked++
+		if analysis.plausible(&candidate, myHills) && analysis.score(&candidate, known) {
+			pass.accepted = append(pass.accepted, &candidate)
+		}
+		return true
+	})
+	sort.Sort(pass.accepted)
+	analysis.Symmetries = pass.accepted
+
+	if finished {
+		analysis.pass = nil
+		analysis.knownAtLast = len(known)
+		analysis.hillsAtLast = enemyHills
+	} else {
+		Log.Printf("Symmetry: ran out of time after checking %v candidates, carrying on from candidate %v next turn", checked, next)
+		pass.next = next
+		analysis.pass = pass
+	}
+
+	analysis.predictHills(myHills)
+	analysis.predictTerrain()
+
+	Log.Printf("Symmetry: %v symmetries fit what we know: %v", len(pass.accepted), pass.accepted)
+	Log.Printf("Symmetry: predicted enemy hills at %v", analysis.PredictedHills)
+}
+
+// stale is whether the inference needs re-running. Until a symmetry fits,
+// that's whenever we've seen a new enemy hill or enough new squares to be
+// worth another try. Once we have symmetries we keep them until something
+// we've seen since contradicts them.
+func (analysis *MapAnalysis) stale(known, enemyHills int) bool {
+	if len(analysis.Symmetries) == 0 {
+		area := analysis.state.Rows * analysis.state.Cols
+		return enemyHills != analysis.hillsAtLast || float64(known-analysis.knownAtLast) >= SymmetryRefresh*float64(area)
+	}
+
+	return analysis.contradicted()
+}
+
+// contradicted is whether a square we've learned since the last inference
+// isn't the terrain it predicted there, or an enemy hill has turned up
+// somewhere it didn't predict one, or not turned up where it did
+func (analysis *MapAnalysis) contradicted() bool {
+	state := analysis.state
+	for i := range state.Grid {
+		terrain := state.Grid[i].terrain
+		if analysis.predicted[i] != Unknown && terrain != Unknown && terrain != analysis.predicted[i] {
+			Log.Printf("Symmetry: %v is %v, not %v as predicted", &state.Grid[i], terrain, analysis.predicted[i])
+			return true
+		}
+	}
+
+	for _, hill := range analysis.enemyHills() {
+		if analysis.HillConfidence(hill) == 0.0 {
+			Log.Printf("Symmetry: found an enemy hill we didn't predict at %v", hill)
+			return true
+		}
+	}
+	for _, prediction := range analysis.PredictedHills {
+		if prediction.Square.observed && !prediction.Square.HasHill() {
+			Log.Printf("Symmetry: no hill at %v as predicted", prediction.Square)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (analysis *MapAnalysis) knownSquares() []*Square {
+	known := make([]*Square, 0)
+	for i := range analysis.state.Grid {
+		if analysis.state.Grid[i].terrain != Unknown {
+			known = append(known, &analysis.state.Grid[i])
+		}
+	}
+
+	return known
+}
+
+func (analysis *MapAnalysis) myHills() []*Square {
+	hills := make([]*Square, 0)
+	for square, item := range AllItems {
+		if item.ItemType() == HillType && item.IsMine() {
+			hills = append(hills, square)
+		}
+	}
+
+	return hills
+}
+
+func (analysis *MapAnalysis) enemyHills() []*Square {
+	hills := make([]*Square, 0)
+	for square, item := range AllItems {
+		if item.ItemType() == HillType && item.IsEnemy() {
+			hills = append(hills, square)
+		}
+	}
+
+	return hills
+}
+
+// eachCandidate calls check with every symmetry that could carry hill
+// onto another player's hill: onto the enemy hills we've seen if any,
+// otherwise onto any square we haven't looked at yet. Candidates are
+// numbered by matrix and then by the target's place in the grid, which
+// doesn't change as we see more of the map, and it starts from number
+// start. If check returns false it stops and returns the number of that
+// candidate; otherwise it reports that it got through them all.
+func (analysis *MapAnalysis) eachCandidate(hill *Square, start int, check func(Symmetry) bool) (int, bool) {
+	state := analysis.state
+	isTarget := func(square *Square) bool {
+		return !square.observed
+	}
+	if len(analysis.enemyHills()) > 0 {
+		isTarget = func(square *Square) bool {
+			return square.HasHill() && square.item.IsEnemy()
+		}
+	}
+
+	row, col := hill.location.Row(state), hill.location.Col(state)
+	size := len(state.Grid)
+	for n := start; n < len(symmetryMatrices)*size; n++ {
+		m, target := symmetryMatrices[n/size], &state.Grid[n%size]
+		if (m.squareOnly && state.Rows != state.Cols) || !isTarget(target) {
+			continue
+		}
+
+		rowShift := state.NormalizeRow(target.location.Row(state) - m.matrix[0]*row - m.matrix[1]*col)
+		colShift := state.NormalizeCol(target.location.Col(state) - m.matrix[2]*row - m.matrix[3]*col)
+		if !check(Symmetry{m.name, m.matrix, rowShift, colShift, 0, 0, 0.0}) {
+			return n, false
+		}
+	}
+
+	return 0, true
+}
+
+// plausible rules out symmetries that put an enemy hill somewhere we can
+// see there isn't one
+func (analysis *MapAnalysis) plausible(sym *Symmetry, myHills []*Square) bool {
+	for _, hill := range myHills {
+		target := sym.Apply(analysis.state, hill)
+		if target == hill || target.IsWater() {
+			return false
+		}
+		if target.observed && !(target.HasHill() && target.item.IsEnemy()) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// score counts how well sym agrees with the known terrain, and reports
+// whether it's good enough to accept. Matching land proves little (most
+// of the map is land) so only matching water counts as evidence.
+func (analysis *MapAnalysis) score(sym *Symmetry, known []*Square) bool {
+	for _, square := range known {
+		image := sym.Apply(analysis.state, square)
+		if image.terrain == Unknown {
+			continue
+		}
+
+		if image.terrain != square.terrain {
+			sym.Conflicts++
+			if float64(sym.Conflicts) > 1+SymmetryTolerance*float64(sym.Agreements) {
+				return false
+			}
+		} else if square.terrain == Water {
+			sym.Agreements++
+		}
+	}
+
+	sym.Confidence = float64(sym.Agreements) / (float64(sym.Agreements+sym.Conflicts) + SymmetryPrior)
+	return sym.Confidence >= MinSymmetryConfidence
+}
+
+// predictHills follows our hills through every combination of the
+// accepted symmetries; a chain is only as believable as its links
+func (analysis *MapAnalysis) predictHills(myHills []*Square) {
+	state := analysis.state
+	best := make(map[*Square]float64)
+	frontier := make([]*HillPrediction, 0)
+	for _, hill := range myHills {
+		best[hill] = 1.0
+		frontier = append(frontier, &HillPrediction{hill, 1.0})
+	}
+
+	for len(frontier) > 0 {
+		prediction := frontier[0]
+		frontier = frontier[1:]
+
+		for _, sym := range analysis.Symmetries {
+			target := sym.Apply(state, prediction.Square)
+			confidence := prediction.Confidence * sym.Confidence
+			if confidence < MinSymmetryConfidence || confidence <= best[target] {
+				continue
+			}
+			if target.IsWater() || (target.observed && !target.HasHill()) {
+				continue
+			}
+
+			best[target] = confidence
+			frontier = append(frontier, &HillPrediction{target, confidence})
+		}
+	}
+
+	analysis.PredictedHills = make([]*HillPrediction, 0)
+	for square, confidence := range best {
+		if !(square.HasHill() && square.item.IsMine()) {
+			analysis.PredictedHills = append(analysis.PredictedHills, &HillPrediction{square, confidence})
+		}
+	}
+}
+
+// predictTerrain fills in each unknown square from the first known square
+// its orbit reaches under the most confident symmetry that reaches one
+func (analysis *MapAnalysis) predictTerrain() {
+	state := analysis.state
+	for i := range state.Grid {
+		square := &state.Grid[i]
+		analysis.predicted[i], analysis.confidence[i] = Unknown, 0.0
+		if square.terrain != Unknown {
+			continue
+		}
+
+	symmetries:
+		for _, sym := range analysis.Symmetries {
+			image := square
+			for steps := 0; steps < 10; steps++ {
+				image = sym.Apply(state, image)
+				if image == square {
+					break
+				}
+				if image.terrain != Unknown {
+					analysis.predicted[i], analysis.confidence[i] = image.terrain, sym.Confidence
+					break symmetries
+				}
+			}
+		}
+	}
+}
+
+func (prediction *HillPrediction) String() string {
+	return fmt.Sprintf("%v (%.2f)", prediction.Square, prediction.Confidence)
+}
+
+// SymmetryList sorts symmetries most confident first
+type SymmetryList []*Symmetry
+
+func (list SymmetryList) Len() int {
+	return len(list)
+}
+
+func (list SymmetryList) Less(i, j int) bool {
+	if math.Abs(list[i].Confidence-list[j].Confidence) < 1e-9 {
+		return list[i].Agreements > list[j].Agreements
+	}
+
+	return list[i].Confidence > list[j].Confidence
+}
+
+func (list SymmetryList) Swap(i, j int) {
+	list[i], list[j] = list[j], list[i]
+}
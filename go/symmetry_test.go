@@ -0,0 +1,63 @@
+package main
+
+import (
+	"rand"
+	"testing"
+)
+
+// translatedState is a 30x20 map that repeats every 10 columns, with
+// our hill at (28, 7) and only columns 0 to 14 seen, so the only enemy
+// hill has to be at (28, 17)
+func translatedState() *State {
+	AllItems = make(ItemSet)
+
+	random := rand.New(rand.NewSource(1))
+	water := make([]bool, 30*10)
+	for i := range water {
+		water[i] = random.Float64() < 0.3
+	}
+
+	s := &State{Rows: 30, Cols: 20, ViewRadius2: 55}
+	s.CreateSquares()
+	for row := 0; row < s.Rows; row++ {
+		for col := 0; col < 15; col++ {
+			square := s.SquareAtRowCol(row, col)
+			square.Observe(s)
+			if water[row*10+col%10] && !(row == 28 && col == 7) {
+				square.Destroy()
+			}
+		}
+	}
+	s.NewHill(0, s.SquareAtRowCol(28, 7))
+
+	return s
+}
+
+func TestSymmetryResumes(t *testing.T) {
+	s := translatedState()
+	analysis := NewMapAnalysis(s)
+
+	// the translation is one of the last candidates of its kind, and a
+	// phase that's out of time only lets a few through each turn
+	turns := 0
+	for turns == 0 || analysis.pass != nil {
+		turns++
+		if turns > 100 {
+			t.Fatalf("still checking candidates after 100 turns")
+		}
+		analysis.Update(&Phase{Name: "analysis"})
+	}
+	if turns == 1 {
+		t.Errorf("checked every candidate in one turn")
+	}
+
+	if confidence := analysis.HillConfidence(s.SquareAtRowCol(28, 17)); confidence < MinSymmetryConfidence {
+		t.Errorf("confidence %.2f in the hill at (28, 17), symmetries %v", confidence, analysis.Symmetries)
+	}
+
+	// with nothing new learned, the inference doesn't run again
+	analysis.Update(&Phase{Name: "analysis"})
+	if analysis.pass != nil {
+		t.Errorf("started another pass with nothing new to go on")
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Telemetry is a per-turn record of where the time went and how much
+// work got done, saved at the end of the game (see Config.Telemetry) so
+// `MyBot telemetry` can summarise many games.
+type Telemetry struct {
+	TurnTime int64 // milliseconds, as the engine gave it
+	Turns    []*TurnTelemetry
+	counters map[string]int
+}
+
+type TurnTelemetry struct {
+	Turn     int
+	Nanos    int64
+	Phases   []*PhaseTelemetry // in the order they ran
+	Counters map[string]int
+}
+
+type PhaseTelemetry struct {
+	Name       string
+	Nanos      int64
+	Iterations int
+	TimedOut   bool
+}
+
+func NewTelemetry(turnTime int64) *Telemetry {
+	return &Telemetry{turnTime, make([]*TurnTelemetry, 0), make(map[string]int)}
+}
+
+// Count adds n to one of this turn's counters
+func (telemetry *Telemetry) Count(name string, n int) {
+	telemetry.counters[name] += n
+}
+
+// EndTurn files this turn's timings and counters
+func (telemetry *Telemetry) EndTurn(turn int, budget *Budget) {
+	phases := make([]*PhaseTelemetry, len(budget.Phases))
+	for i, phase := range budget.Phases {
+		phases[i] = &PhaseTelemetry{phase.Name, phase.Nanos, phase.Iterations, phase.TimedOut}
+	}
+
+	telemetry.Turns = append(telemetry.Turns, &TurnTelemetry{turn, budget.Nanos, phases, telemetry.counters})
+	telemetry.counters = make(map[string]int)
+}
+
+// Save writes CSV if filename ends in .csv, JSON otherwise
+func (telemetry *Telemetry) Save(filename string) os.Error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.HasSuffix(filename, ".csv") {
+		return telemetry.WriteCSV(file)
+	}
+	return telemetry.WriteJSON(file)
+}
+
+func (telemetry *Telemetry) WriteJSON(w io.Writer) os.Error {
+	data, err := json.Marshal(telemetry)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// WriteCSV writes one row per turn: the turn, its time in nanoseconds,
+// then a column per phase and per counter
+func (telemetry *Telemetry) WriteCSV(w io.Writer) os.Error {
+	phases, counters := telemetry.columns()
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "turntime,%v\n", telemetry.TurnTime)
+	header := []string{"turn", "nanos"}
+	for _, phase := range phases {
+		header = append(header, phase+"_nanos", phase+"_iterations", phase+"_timedout")
+	}
+	header = append(header, counters...)
+	fmt.Fprintln(out, strings.Join(header, ","))
+
+	for _, turn := range telemetry.Turns {
+		row := []string{strconv.Itoa(turn.Turn), strconv.Itoa64(turn.Nanos)}
+		for _, name := range phases {
+			phase := turn.phase(name)
+			if phase == nil {
+				row = append(row, "", "", "")
+			} else {
+				row = append(row, strconv.Itoa64(phase.Nanos), strconv.Itoa(phase.Iterations), fmt.Sprint(phase.TimedOut))
+			}
+		}
+		for _, name := range counters {
+			row = append(row, strconv.Itoa(turn.Counters[name]))
+		}
+		fmt.Fprintln(out, strings.Join(row, ","))
+	}
+
+	return out.Flush()
+}
+
+// columns are every phase name in the order first seen, and every
+// counter name sorted
+func (telemetry *Telemetry) columns() ([]string, []string) {
+	phases := make([]string, 0)
+	seenPhases := make(map[string]bool)
+	seenCounters := make(map[string]bool)
+	for _, turn := range telemetry.Turns {
+		for _, phase := range turn.Phases {
+			if !seenPhases[phase.Name] {
+				seenPhases[phase.Name] = true
+				phases = append(phases, phase.Name)
+			}
+		}
+		for name := range turn.Counters {
+			seenCounters[name] = true
+		}
+	}
+
+	counters := make([]string, 0, len(seenCounters))
+	for name := range seenCounters {
+		counters = append(counters, name)
+	}
+	sort.Strings(counters)
+
+	return phases, counters
+}
+
+func (turn *TurnTelemetry) phase(name string) *PhaseTelemetry {
+	for _, phase := range turn.Phases {
+		if phase.Name == name {
+			return phase
+		}
+	}
+	return nil
+}
+
+func LoadTelemetry(filename string) (*Telemetry, os.Error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(filename, ".csv") {
+		return parseTelemetryCSV(filename, string(data))
+	}
+
+	telemetry := NewTelemetry(0)
+	err = json.Unmarshal(data, telemetry)
+	if err != nil {
+		return nil, os.NewError(fmt.Sprintf("telemetry %v: %v", filename, err))
+	}
+	return telemetry, nil
+}
+
+func parseTelemetryCSV(filename, data string) (*Telemetry, os.Error) {
+	lines := strings.Split(strings.TrimRight(data, "\n"), "\n")
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "turntime,") {
+		return nil, os.NewError(fmt.Sprintf("telemetry %v: missing header", filename))
+	}
+
+	turnTime, err := strconv.Atoi64(lines[0][len("turntime,"):])
+	if err != nil {
+		return nil, os.NewError(fmt.Sprintf("telemetry %v: invalid turn time", filename))
+	}
+	telemetry := NewTelemetry(turnTime)
+
+	header := strings.Split(lines[1], ",")
+	for lineNumber, line := range lines[2:] {
+		fields := strings.Split(line, ",")
+		if len(fields) != len(header) || len(fields) < 2 {
+			return nil, os.NewError(fmt.Sprintf("telemetry %v: line %v has %v fields, expected %v", filename, lineNumber+3, len(fields), len(header)))
+		}
+
+		turn := &TurnTelemetry{Phases: make([]*PhaseTelemetry, 0), Counters: make(map[string]int)}
+		turn.Turn, _ = strconv.Atoi(fields[0])
+		turn.Nanos, _ = strconv.Atoi64(fields[1])
+		for i := 2; i < len(header); i++ {
+			switch {
+			case strings.HasSuffix(header[i], "_nanos"):
+				if fields[i] == "" {
+					i += 2
+					continue
+				}
+				phase := &PhaseTelemetry{Name: header[i][:len(header[i])-len("_nanos")]}
+				phase.Nanos, _ = strconv.Atoi64(fields[i])
+				phase.Iterations, _ = strconv.Atoi(fields[i+1])
+				phase.TimedOut = fields[i+2] == "true"
+				turn.Phases = append(turn.Phases, phase)
+				i += 2
+			default:
+				turn.Counters[header[i]], _ = strconv.Atoi(fields[i])
+			}
+		}
+		telemetry.Turns = append(telemetry.Turns, turn)
+	}
+
+	return telemetry, nil
+}
+
+// Percentile is the nearest-rank percentile of sorted values
+func Percentile(sorted []int64, percent float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := (int)(percent/100.0*(float64)(len(sorted))+0.999999) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+type int64List []int64
+
+func (list int64List) Len() int           { return len(list) }
+func (list int64List) Less(i, j int) bool { return list[i] < list[j] }
+func (list int64List) Swap(i, j int)      { list[i], list[j] = list[j], list[i] }
+
+// TelemetryCommand is `MyBot telemetry FILE...`: latency percentiles for
+// whole turns and each phase, and counter averages, across games
+func TelemetryCommand(args []string) os.Error {
+	flags := flag.NewFlagSet("telemetry", flag.ExitOnError)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return os.NewError("usage: MyBot telemetry FILE...")
+	}
+
+	names := []string{"turn"}
+	latencies := map[string]int64List{"turn": make(int64List, 0)}
+	timeouts := make(map[string]int)
+	counterTotals := make(map[string]int)
+	counterMax := make(map[string]int)
+	turns, overBudget := 0, 0
+	turnTime := int64(0)
+
+	for _, filename := range flags.Args() {
+		telemetry, err := LoadTelemetry(filename)
+		if err != nil {
+			return err
+		}
+		if telemetry.TurnTime > turnTime {
+			turnTime = telemetry.TurnTime
+		}
+
+		for _, turn := range telemetry.Turns {
+			turns++
+			latencies["turn"] = append(latencies["turn"], turn.Nanos)
+			if telemetry.TurnTime > 0 && turn.Nanos > telemetry.TurnTime*1000000 {
+				overBudget++
+			}
+
+			for _, phase := range turn.Phases {
+				if _, ok := latencies[phase.Name]; !ok {
+					names = append(names, phase.Name)
+					latencies[phase.Name] = make(int64List, 0)
+				}
+				latencies[phase.Name] = append(latencies[phase.Name], phase.Nanos)
+				if phase.TimedOut {
+					timeouts[phase.Name]++
+				}
+			}
+
+			for name, count := range turn.Counters {
+				counterTotals[name] += count
+				if count > counterMax[name] {
+					counterMax[name] = count
+				}
+			}
+		}
+	}
+
+	fmt.Printf("%v turns from %v games, turntime %vms, %v turns over turntime\n\n", turns, flags.NArg(), turnTime, overBudget)
+	fmt.Printf("%-10s %9s %9s %9s %9s %9s %9s\n", "phase (ms)", "p50", "p90", "p99", "max", "mean", "timeouts")
+	for _, name := range names {
+		values := latencies[name]
+		sort.Sort(values)
+		total := int64(0)
+		for _, value := range values {
+			total += value
+		}
+		mean := 0.0
+		if len(values) > 0 {
+			mean = (float64)(total) / (float64)(len(values)) / 1e6
+		}
+
+		fmt.Printf("%-10s %9.2f %9.2f %9.2f %9.2f %9.2f %9d\n", name,
+			(float64)(Percentile(values, 50))/1e6, (float64)(Percentile(values, 90))/1e6,
+			(float64)(Percentile(values, 99))/1e6, (float64)(Percentile(values, 100))/1e6, mean, timeouts[name])
+	}
+
+	counters := make([]string, 0, len(counterTotals))
+	for name := range counterTotals {
+		counters = append(counters, name)
+	}
+	sort.Strings(counters)
+
+	fmt.Printf("\n%-16s %9s %9s\n", "counter", "mean", "max")
+	for _, name := range counters {
+		fmt.Printf("%-16s %9.1f %9d\n", name, (float64)(counterTotals[name])/(float64)(turns), counterMax[name])
+	}
+
+	return nil
+}
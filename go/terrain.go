@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"io"
+)
+
+// What we know about the ground under a square
+type Terrain int
+
+const (
+	Unknown Terrain = iota
+	Land
+	Water
+)
+
+// String is the terrain's symbol in the .map format, with '?' for unknown
+func (terrain Terrain) String() string {
+	switch terrain {
+	case Land:
+		return "."
+	case Water:
+		return "%"
+	}
+	return "?"
+}
+
+// TerrainString draws the known terrain, one line per row
+func (state *State) TerrainString() string {
+	var buffer bytes.Buffer
+	for row := 0; row < state.Rows; row++ {
+		for col := 0; col < state.Cols; col++ {
+			buffer.WriteString(state.SquareAtRowCol(row, col).terrain.String())
+		}
+		buffer.WriteByte('\n')
+	}
+
+	return buffer.String()
+}
+
+func (state *State) DumpTerrain(w io.Writer) {
+	io.WriteString(w, state.TerrainString())
+}
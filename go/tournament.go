@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bufio"
+	"exec"
+	"flag"
+	"fmt"
+	"json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TournamentCommand is `MyBot tournament [flags] BOT...`: play bots
+// against each other on every map in a directory and rate them, to
+// tell whether a change actually helps. Each round is either a round
+// robin, where every group of bots that fits a map plays on it, or Swiss,
+// where bots are grouped with others of a similar rating. Seats rotate
+// from round to round. Results are appended to a JSON lines file as each
+// game ends, and ratings are rebuilt from that file on every run, so a
+// tournament can be stopped and carried on later, or extended with new
+// bots.
+//
+// Each BOT is NAME=COMMAND, or the name of one of the SampleBots to run
+// it with this binary. Games are played by the engine in engine.go, or
+// with -playgame by the official playgame.py.
+func TournamentCommand(args []string) os.Error {
+	flags := flag.NewFlagSet("tournament", flag.ExitOnError)
+	maps := flags.String("maps", "maps", "directory of .map files (and subdirectories of them)")
+	playerCounts := flags.String("players", "", "comma separated player counts to play, or all counts with maps")
+	format := flags.String("format", "roundrobin", "how to pick each round's games: roundrobin or swiss")
+	rounds := flags.Int("rounds", 1, "number of rounds to play")
+	parallel := flags.Int("parallel", 2, "number of games to play at once")
+	results := flags.String("results", "tournament.jsonl", "file results are appended to and ratings rebuilt from")
+	seed := flags.Int64("seed", 1, "seed for the first game; later games, including those of later runs, count up from it")
+	playgame := flags.String("playgame", "", "path to playgame.py, to play with the official engine instead")
+	options := DefaultGameOptions()
+	flags.IntVar(&options.Turns, "turns", options.Turns, "turns per game")
+	flags.Int64Var(&options.LoadTime, "loadtime", options.LoadTime, "milliseconds bots get to start up")
+	flags.Int64Var(&options.TurnTime, "turntime", options.TurnTime, "milliseconds bots get each turn")
+	flags.IntVar(&options.FoodRate, "foodrate", options.FoodRate, "food per player every ten turns")
+	flags.Parse(args)
+
+	if flags.NArg() < 2 {
+		return os.NewError("usage: MyBot tournament [flags] NAME=COMMAND|SAMPLEBOT...")
+	}
+	if *format != "roundrobin" && *format != "swiss" {
+		return os.NewError("tournament: unknown format " + *format)
+	}
+
+	tournament := NewTournament(options, *parallel)
+	tournament.Playgame = *playgame
+	for _, arg := range flags.Args() {
+		if _, ok := SampleBots[arg]; ok {
+			arg = fmt.Sprintf("%v=%v -bot %v", arg, os.Args[0], arg)
+		}
+
+		equals := strings.Index(arg, "=")
+		if equals < 1 {
+			return os.NewError("tournament: expected NAME=COMMAND, not " + arg)
+		}
+		err := tournament.AddBot(arg[:equals], arg[equals+1:])
+		if err != nil {
+			return err
+		}
+	}
+
+	counts := make(map[int]bool)
+	if *playerCounts != "" {
+		for _, word := range strings.Split(*playerCounts, ",") {
+			count, err := strconv.Atoi(word)
+			if err != nil || count < 2 {
+				return os.NewError("tournament: invalid player count " + word)
+			}
+			counts[count] = true
+		}
+	}
+	err := tournament.LoadMaps(*maps, counts)
+	if err != nil {
+		return err
+	}
+
+	err = tournament.Resume(*results)
+	if err != nil {
+		return err
+	}
+	err = tournament.Play(*format, *rounds, *seed)
+	tournament.PrintLeaderboard()
+	return err
+}
+
+// MatchResult is one game of a tournament, and a line of the results
+// file. Bots, Scores and Status are in seat order.
+type MatchResult struct {
+	Round  int
+	Map    string
+	Seed   int64
+	Bots   []string
+	Scores []int
+	Status []string
+	Turns  int
+	Error  string // why the game couldn't be played, in which case it isn't rated
+}
+
+type Tournament struct {
+	Options  *GameOptions
+	Parallel int
+	Playgame string // path to playgame.py, or "" for the local engine
+
+	bots     []string          // names, in the order given
+	commands map[string]string // command line for each bot
+	maps     []string
+	loaded   map[string]*MapFile
+	ratings  map[string]*Rating
+	results  *os.File
+	round    int   // last round played
+	seed     int64 // the next game's seed
+}
+
+func NewTournament(options *GameOptions, parallel int) *Tournament {
+	if parallel < 1 {
+		parallel = 1
+	}
+	return &Tournament{
+		Options:  options,
+		Parallel: parallel,
+		bots:     make([]string, 0),
+		commands: make(map[string]string),
+		maps:     make([]string, 0),
+		loaded:   make(map[string]*MapFile),
+		ratings:  make(map[string]*Rating),
+	}
+}
+
+func (tournament *Tournament) AddBot(name, command string) os.Error {
+	if _, ok := tournament.commands[name]; ok {
+		return os.NewError("tournament: two bots called " + name)
+	}
+
+	tournament.bots = append(tournament.bots, name)
+	tournament.commands[name] = command
+	tournament.rating(name)
+	return nil
+}
+
+func (tournament *Tournament) rating(name string) *Rating {
+	rating, ok := tournament.ratings[name]
+	if !ok {
+		rating = NewRating(name)
+		tournament.ratings[name] = rating
+	}
+	return rating
+}
+
+// LoadMaps finds the maps under dir for the given player counts (any if
+// counts is empty) that there are enough bots to play
+func (tournament *Tournament) LoadMaps(dir string, counts map[int]bool) os.Error {
+	filenames := make([]string, 0)
+	for _, pattern := range []string{"*.map", filepath.Join("*", "*.map")} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return err
+		}
+		filenames = append(filenames, matches...)
+	}
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		m, err := LoadMap(filename)
+		if err != nil {
+			return os.NewError(fmt.Sprintf("tournament: %v: %v", filename, err))
+		}
+		if m.Players > len(tournament.bots) || (len(counts) > 0 && !counts[m.Players]) {
+			continue
+		}
+
+		tournament.maps = append(tournament.maps, filename)
+		tournament.loaded[filename] = m
+	}
+
+	if len(tournament.maps) == 0 {
+		return os.NewError(fmt.Sprintf("tournament: no maps in %v for %v bots", dir, len(tournament.bots)))
+	}
+	return nil
+}
+
+// Resume rates every game already in the results file, then opens it to
+// append to
+func (tournament *Tournament) Resume(filename string) os.Error {
+	if _, err := os.Stat(filename); err == nil {
+		previous, err := LoadResults(filename)
+		if err != nil {
+			return err
+		}
+		for _, result := range previous {
+			tournament.rate(result)
+		}
+	}
+
+	var err os.Error
+	tournament.results, err = os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	return err
+}
+
+func LoadResults(filename string) ([]*MatchResult, os.Error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	results := make([]*MatchResult, 0)
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			result := new(MatchResult)
+			jsonErr := json.Unmarshal([]byte(line), result)
+			if jsonErr != nil {
+				return nil, os.NewError(fmt.Sprintf("%v:%v: %v", filename, lineNumber, jsonErr))
+			}
+			results = append(results, result)
+		}
+
+		if err == os.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// rate updates the ratings of the bots in a game
+func (tournament *Tournament) rate(result *MatchResult) {
+	if result.Round > tournament.round {
+		tournament.round = result.Round
+	}
+	if result.Seed >= tournament.seed {
+		tournament.seed = result.Seed + 1
+	}
+	if result.Error != "" {
+		return
+	}
+
+	ratings := make([]*Rating, len(result.Bots))
+	for i, name := range result.Bots {
+		ratings[i] = tournament.rating(name)
+	}
+	UpdateRatings(ratings, result.Scores)
+}
+
+// Play plays rounds more rounds, one after another, with each round's
+// games spread over Parallel workers
+func (tournament *Tournament) Play(format string, rounds int, seed int64) os.Error {
+	defer tournament.results.Close()
+
+	if seed > tournament.seed {
+		tournament.seed = seed
+	}
+
+	for i := 0; i < rounds; i++ {
+		tournament.round++
+		var matches []*MatchResult
+		if format == "swiss" {
+			matches = tournament.swissRound()
+		} else {
+			matches = tournament.roundRobin()
+		}
+		for _, match := range matches {
+			match.Seed = tournament.seed
+			tournament.seed++
+		}
+
+		fmt.Printf("round %v: %v games\n", tournament.round, len(matches))
+		err := tournament.playRound(matches)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// roundRobin is a game for each map and each group of bots of its size,
+// seated according to the round
+func (tournament *Tournament) roundRobin() []*MatchResult {
+	matches := make([]*MatchResult, 0)
+	for _, filename := range tournament.maps {
+		players := tournament.loaded[filename].Players
+		for _, group := range combinations(len(tournament.bots), players) {
+			bots := make([]string, players)
+			for seat := range bots {
+				bots[seat] = tournament.bots[group[(seat+tournament.round)%players]]
+			}
+			matches = append(matches, tournament.newMatch(filename, bots))
+		}
+	}
+	return matches
+}
+
+// combinations are every way of choosing k of n things, in order
+func combinations(n, k int) [][]int {
+	if k == 0 {
+		return [][]int{[]int{}}
+	}
+
+	all := make([][]int, 0)
+	for first := k - 1; first < n; first++ {
+		for _, rest := range combinations(first, k-1) {
+			all = append(all, append(rest, first))
+		}
+	}
+	return all
+}
+
+// swissRound is a game on each map, with the bots sorted by rating and
+// grouped with their neighbours. Bots left over when the map's player
+// count doesn't divide evenly sit that map out; which ones changes as the
+// ratings do.
+func (tournament *Tournament) swissRound() []*MatchResult {
+	standings := tournament.standings(tournament.bots)
+
+	matches := make([]*MatchResult, 0)
+	for _, filename := range tournament.maps {
+		players := tournament.loaded[filename].Players
+		for start := 0; start+players <= len(standings); start += players {
+			bots := make([]string, players)
+			for seat := range bots {
+				bots[seat] = standings[start+(seat+tournament.round)%players].Name
+			}
+			matches = append(matches, tournament.newMatch(filename, bots))
+		}
+	}
+	return matches
+}
+
+func (tournament *Tournament) newMatch(filename string, bots []string) *MatchResult {
+	return &MatchResult{Round: tournament.round, Map: filename, Bots: bots}
+}
+
+// playRound plays matches in parallel, recording and rating each as it
+// finishes
+func (tournament *Tournament) playRound(matches []*MatchResult) os.Error {
+	queue := make(chan *MatchResult, len(matches))
+	for _, match := range matches {
+		queue <- match
+	}
+	close(queue)
+
+	finished := make(chan *MatchResult)
+	var workers sync.WaitGroup
+	for i := 0; i < tournament.Parallel; i++ {
+		workers.Add(1)
+		go func() {
+			for match := range queue {
+				tournament.playMatch(match)
+				finished <- match
+			}
+			workers.Done()
+		}()
+	}
+	go func() {
+		workers.Wait()
+		close(finished)
+	}()
+
+	var saveErr os.Error
+	for result := range finished {
+		tournament.rate(result)
+		if saveErr == nil {
+			saveErr = tournament.save(result)
+		}
+		fmt.Println(result)
+	}
+
+	return saveErr
+}
+
+func (tournament *Tournament) save(result *MatchResult) os.Error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	_, err = tournament.results.Write(append(data, '\n'))
+	return err
+}
+
+func (result *MatchResult) String() string {
+	if result.Error != "" {
+		return fmt.Sprintf("  %v: %v: %v", filepath.Base(result.Map), strings.Join(result.Bots, " v "), result.Error)
+	}
+
+	players := make([]string, len(result.Bots))
+	for i, name := range result.Bots {
+		players[i] = fmt.Sprintf("%v %v (%v)", name, result.Scores[i], result.Status[i])
+	}
+	return fmt.Sprintf("  %v: %v after %v turns", filepath.Base(result.Map), strings.Join(players, ", "), result.Turns)
+}
+
+// playMatch fills in the result of a game
+func (tournament *Tournament) playMatch(match *MatchResult) {
+	options := *tournament.Options
+	options.Seed = match.Seed
+
+	var err os.Error
+	if tournament.Playgame != "" {
+		err = tournament.playgameMatch(match, &options)
+	} else {
+		err = tournament.localMatch(match, &options)
+	}
+	if err != nil {
+		match.Error = err.String()
+	}
+}
+
+func (tournament *Tournament) localMatch(match *MatchResult, options *GameOptions) os.Error {
+	players := make([]*EnginePlayer, 0, len(match.Bots))
+	for _, name := range match.Bots {
+		player, err := StartPlayer(name, tournament.commands[name])
+		if err != nil {
+			for _, started := range players {
+				started.stop()
+			}
+			return err
+		}
+		players = append(players, player)
+	}
+
+	game, err := NewLocalGame(tournament.loaded[match.Map], players, options)
+	if err != nil {
+		for _, player := range players {
+			player.stop()
+		}
+		return err
+	}
+	game.Play()
+
+	match.Scores = game.Scores
+	match.Turns = game.Turn
+	match.Status = make([]string, len(players))
+	for i, player := range players {
+		match.Status[i] = player.Status
+	}
+	return nil
+}
+
+// playgameMatch runs playgame.py and reads the "score", "status" and
+// "playerturns" lines it prints at the end of the game
+func (tournament *Tournament) playgameMatch(match *MatchResult, options *GameOptions) os.Error {
+	args := []string{tournament.Playgame,
+		"--map_file", match.Map,
+		"--turns", strconv.Itoa(options.Turns),
+		"--loadtime", strconv.Itoa64(options.LoadTime),
+		"--turntime", strconv.Itoa64(options.TurnTime),
+		"--player_seed", strconv.Itoa64(options.Seed),
+		"--engine_seed", strconv.Itoa64(options.Seed),
+		"--nolaunch", "--verbose"}
+	for _, name := range match.Bots {
+		args = append(args, tournament.commands[name])
+	}
+
+	output, err := exec.Command("python", args...).Output()
+	if err != nil {
+		return os.NewError(fmt.Sprintf("playgame: %v", err))
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		words := strings.Fields(line)
+		if len(words) < 2 {
+			continue
+		}
+
+		switch words[0] {
+		case "score":
+			match.Scores = make([]int, len(words)-1)
+			for i, word := range words[1:] {
+				match.Scores[i], _ = strconv.Atoi(word)
+			}
+		case "status":
+			match.Status = words[1:]
+		case "playerturns":
+			for _, word := range words[1:] {
+				turns, _ := strconv.Atoi(word)
+				if turns > match.Turns {
+					match.Turns = turns
+				}
+			}
+		}
+	}
+
+	if len(match.Scores) != len(match.Bots) || len(match.Status) != len(match.Bots) {
+		return os.NewError("playgame: no scores in its output")
+	}
+	return nil
+}
+
+// standings are the named bots' ratings, best first
+func (tournament *Tournament) standings(names []string) []*Rating {
+	standings := make(ratingList, len(names))
+	for i, name := range names {
+		standings[i] = tournament.rating(name)
+	}
+	sort.Sort(standings)
+	return standings
+}
+
+func (tournament *Tournament) PrintLeaderboard() {
+	names := make([]string, 0, len(tournament.ratings))
+	for name := range tournament.ratings {
+		names = append(names, name)
+	}
+
+	fmt.Printf("\n%-20s %6s %9s %8s %7s %7s %8s\n", "bot", "games", "mean rank", "elo", "mu", "sigma", "mu-3sig")
+	for _, rating := range tournament.standings(names) {
+		fmt.Printf("%-20s %6d %9.2f %8.1f %7.2f %7.2f %8.2f\n", rating.Name, rating.Games, rating.MeanRank(),
+			rating.Elo, rating.Mu, rating.Sigma, rating.Conservative())
+	}
+}
+
+type ratingList []*Rating
+
+func (list ratingList) Len() int      { return len(list) }
+func (list ratingList) Swap(i, j int) { list[i], list[j] = list[j], list[i] }
+func (list ratingList) Less(i, j int) bool {
+	if list[i].Conservative() != list[j].Conservative() {
+		return list[i].Conservative() > list[j].Conservative()
+	}
+	return list[i].Name < list[j].Name
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ANSI escapes for drawing the map
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiClear   = "\x1b[H\x1b[2J"
+	ansiWater   = "\x1b[44m"
+	ansiFog     = "\x1b[100m"
+	ansiLand    = "\x1b[2m"
+	ansiCovered = "\x1b[42m"
+	ansiFood    = "\x1b[1;33m"
+	ansiNoGoal  = "\x1b[1;37m"
+)
+
+// Colours for players, ours first, and for our ants by goal type
+var ansiPlayers = []string{"\x1b[1;32m", "\x1b[1;31m", "\x1b[1;35m", "\x1b[1;36m", "\x1b[1;33m", "\x1b[1;34m", "\x1b[1;91m", "\x1b[1;95m", "\x1b[1;96m", "\x1b[1;93m"}
+
+var ansiGoals = map[string]string{
+	"eat":     "\x1b[1;33m",
+	"explore": "\x1b[1;36m",
+	"raze":    "\x1b[1;31m",
+}
+
+// ViewCommand is `MyBot view [flags] SOURCE`: draw what the bot believes
+// each turn, in colour, in a terminal. SOURCE is one of
+//
+//   -          engine input on stdin, e.g. teed from a live game; each
+//              turn is drawn as it's played
+//   DIR        a directory of snapshots from -snapshots
+//   FILE.json  a single snapshot
+//   FILE       a recording, replayed with the given flags
+//
+// Other than live, the viewer steps through the turns: enter or n for
+// the next turn, p for the previous one, a number to go to that turn,
+// f and a goal type (eat, explore, raze or none) to show how far that
+// goal's distance field has searched, and q to quit. With -all it just
+// prints every turn.
+func ViewCommand(args []string) os.Error {
+	all := false
+	field := ""
+	config, flags, err := ParseConfig("view", args, func(flags *flag.FlagSet) {
+		flags.BoolVar(&all, "all", false, "print every turn instead of stepping through them")
+		flags.StringVar(&field, "field", "", "show the coverage of this goal type's distance field")
+	})
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return os.NewError("usage: MyBot view [flags] SOURCE")
+	}
+
+	viewer := &Viewer{out: os.Stdout, field: field}
+	source := flags.Arg(0)
+	if source == "-" {
+		return viewer.Live(NewSession(os.Stdin, new(bytes.Buffer)), config)
+	}
+
+	frames, err := LoadFrames(source, config)
+	if err != nil {
+		return err
+	}
+	if len(frames) == 0 {
+		return os.NewError("view: no turns in " + source)
+	}
+
+	if all {
+		for _, frame := range frames {
+			viewer.Draw(frame)
+		}
+		return nil
+	}
+
+	return viewer.Step(frames, os.Stdin)
+}
+
+// LoadFrames gets every turn's snapshot from a snapshot file, a
+// directory of them, or by replaying a recording
+func LoadFrames(source string, config *Config) ([]*Snapshot, os.Error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDirectory() {
+		filenames, err := filepath.Glob(filepath.Join(source, "turn-*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(filenames)
+
+		frames := make([]*Snapshot, 0, len(filenames))
+		for _, filename := range filenames {
+			frame, err := LoadSnapshot(filename)
+			if err != nil {
+				return nil, err
+			}
+			frames = append(frames, frame)
+		}
+		return frames, nil
+	}
+
+	if strings.HasSuffix(source, ".json") {
+		frame, err := LoadSnapshot(source)
+		if err != nil {
+			return nil, err
+		}
+		return []*Snapshot{frame}, nil
+	}
+
+	recording, err := LoadRecording(source)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]*Snapshot, 0)
+	config.IgnoreTimeBudget = true
+	err = PlayAndWatch(NewSession(strings.NewReader(recording.InputString()), new(bytes.Buffer)), config, func(s *State) {
+		frames = append(frames, s.Snapshot())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return frames, nil
+}
+
+type Viewer struct {
+	out   io.Writer
+	field string // goal type whose field coverage is shown, or ""
+}
+
+// Live plays along with a game, drawing each turn as it ends
+func (viewer *Viewer) Live(session *Session, config *Config) os.Error {
+	return PlayAndWatch(session, config, func(s *State) {
+		io.WriteString(viewer.out, ansiClear)
+		viewer.Draw(s.Snapshot())
+	})
+}
+
+// Step draws one frame at a time, taking commands from in
+func (viewer *Viewer) Step(frames []*Snapshot, in io.Reader) os.Error {
+	commands := bufio.NewReader(in)
+	current := 0
+	message := ""
+	for {
+		io.WriteString(viewer.out, ansiClear)
+		viewer.Draw(frames[current])
+		fmt.Fprintf(viewer.out, "%v[n]ext [p]rev [TURN] [f]ield eat|explore|raze|none [q]uit> ", message)
+		message = ""
+
+		line, err := commands.ReadString('\n')
+		if err != nil {
+			// stdin ran out; leave the last frame on screen
+			fmt.Fprintln(viewer.out)
+			break
+		}
+
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			words = []string{"n"}
+		}
+
+		switch words[0] {
+		case "n":
+			if current < len(frames)-1 {
+				current++
+			}
+		case "p":
+			if current > 0 {
+				current--
+			}
+		case "f":
+			if len(words) != 2 {
+				message = "which field? "
+				break
+			}
+			viewer.field = words[1]
+			if viewer.field == "none" {
+				viewer.field = ""
+			}
+		case "q":
+			return nil
+		default:
+			turn, err := strconv.Atoi(words[0])
+			if err != nil {
+				message = fmt.Sprintf("unknown command %q; ", words[0])
+				break
+			}
+			found := false
+			for i, frame := range frames {
+				if frame.Turn == turn {
+					current, found = i, true
+				}
+			}
+			if !found {
+				message = fmt.Sprintf("no turn %v; ", turn)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Draw prints one turn: a status line, the map and a legend. Anything a
+// damaged or hand-edited snapshot puts off the map is left out.
+func (viewer *Viewer) Draw(frame *Snapshot) {
+	rows, cols := frame.Rows, frame.Cols
+	if rows < 0 || cols < 0 {
+		rows, cols = 0, 0
+	}
+	cells := make([]string, rows*cols)
+	for i := range cells {
+		cells[i] = ansiFog + " " + ansiReset
+	}
+	set := func(row, col int, cell string) {
+		if row >= 0 && row < rows && col >= 0 && col < cols {
+			cells[row*cols+col] = cell
+		}
+	}
+
+	for row, line := range frame.Terrain {
+		for col, symbol := range []byte(line) {
+			switch symbol {
+			case '%', '#':
+				set(row, col, ansiWater+" "+ansiReset)
+			case '?':
+				set(row, col, ansiFog+" "+ansiReset)
+			default:
+				set(row, col, ansiLand+"."+ansiReset)
+			}
+		}
+	}
+
+	for _, field := range frame.Fields {
+		if field.Type != viewer.field {
+			continue
+		}
+		for row, line := range field.Steps {
+			for col, step := range []byte(line) {
+				if step != '.' {
+					set(row, col, ansiCovered+"."+ansiReset)
+				}
+			}
+		}
+	}
+
+	food := 0
+	for _, item := range frame.Items {
+		switch item.Type {
+		case "food":
+			food++
+			set(item.Row, item.Col, ansiFood+"*"+ansiReset)
+		case "hill":
+			set(item.Row, item.Col, ansiPlayer(item.Owner)+ansiBold+strconv.Itoa(item.Owner%10)+ansiReset)
+		}
+	}
+
+	for _, enemy := range frame.EnemyAnts {
+		set(enemy.Row, enemy.Col, ansiPlayer(enemy.Owner)+fmt.Sprintf("%c", 'a'+enemy.Owner%26)+ansiReset)
+	}
+
+	goalTypes := make(map[GoalId]string)
+	for _, goal := range frame.Goals {
+		goalTypes[goal.Id] = goal.Type
+	}
+	for _, ant := range frame.Ants {
+		colour, ok := ansiGoals[goalTypes[ant.Goal]]
+		if !ok {
+			colour = ansiNoGoal
+		}
+		// arrow wraps around the map, so needs the ant to be on it
+		if ant.Row >= 0 && ant.Row < rows && ant.Col >= 0 && ant.Col < cols {
+			set(ant.Row, ant.Col, colour+string(frame.arrow(ant))+ansiReset)
+		}
+	}
+
+	out := bufio.NewWriter(viewer.out)
+	coverage := viewer.field
+	if coverage == "" {
+		coverage = "none"
+	}
+	fmt.Fprintf(out, "turn %v of %v: %v ants, %v enemy ants in view, %v food, %v goals, %v nodes queued; field coverage: %v\n",
+		frame.Turn, frame.Turns, len(frame.Ants), len(frame.EnemyAnts), food, len(frame.Goals), frame.SearchQueue, coverage)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			out.WriteString(cells[row*cols+col])
+		}
+		out.WriteByte('\n')
+	}
+	legend := []string{
+		ansiWater + " " + ansiReset + " water",
+		ansiFog + " " + ansiReset + " unseen",
+		ansiCovered + " " + ansiReset + " field coverage",
+		ansiFood + "*" + ansiReset + " food",
+		ansiPlayer(0) + "0" + ansiReset + " hill",
+		ansiGoals["eat"] + "^" + ansiReset + " ant going to eat",
+		ansiGoals["explore"] + "^" + ansiReset + " explore",
+		ansiGoals["raze"] + "^" + ansiReset + " raze",
+		ansiNoGoal + "o" + ansiReset + " no goal",
+		ansiPlayer(1) + "b" + ansiReset + " enemy ant",
+	}
+	fmt.Fprintln(out, strings.Join(legend, "  "))
+	out.Flush()
+}
+
+func ansiPlayer(owner int) string {
+	i := owner % len(ansiPlayers)
+	if i < 0 {
+		i += len(ansiPlayers)
+	}
+	return ansiPlayers[i]
+}
+
+// arrow points the way an ant's route takes it, or is 'o' if it isn't
+// going anywhere
+func (frame *Snapshot) arrow(ant *AntSnapshot) byte {
+	if len(ant.Route) < 2 {
+		return 'o'
+	}
+
+	next := ant.Route[1]
+	if next == nil {
+		return 'o'
+	}
+	switch {
+	case next.Row == (ant.Row+frame.Rows-1)%frame.Rows && next.Col == ant.Col:
+		return '^'
+	case next.Row == (ant.Row+1)%frame.Rows && next.Col == ant.Col:
+		return 'v'
+	case next.Col == (ant.Col+frame.Cols-1)%frame.Cols && next.Row == ant.Row:
+		return '<'
+	case next.Col == (ant.Col+1)%frame.Cols && next.Row == ant.Row:
+		return '>'
+	}
+	return 'o'
+}
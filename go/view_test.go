@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestDrawOffMap draws a snapshot with things off its map, which should
+// leave them out rather than crash
+func TestDrawOffMap(t *testing.T) {
+	frame := &Snapshot{
+		Rows:    2,
+		Cols:    3,
+		Terrain: []string{"..%.", "?.", "..."},
+		Items:   []*ItemSnapshot{&ItemSnapshot{2, 0, "food", 0, 1}, &ItemSnapshot{0, -1, "hill", -3, 1}, &ItemSnapshot{1, 1, "hill", 1, 1}},
+		Ants: []*AntSnapshot{
+			&AntSnapshot{5, 5, 1, -1, nil},
+			&AntSnapshot{0, 3, 2, -1, nil},
+			&AntSnapshot{1, 2, 3, -1, []*SquareSnapshot{&SquareSnapshot{1, 2}, nil}},
+			&AntSnapshot{0, 0, 4, -1, []*SquareSnapshot{&SquareSnapshot{0, 0}, &SquareSnapshot{0, 1}}},
+		},
+		EnemyAnts: []*EnemyAntSnapshot{&EnemyAntSnapshot{-1, 0, 1}, &EnemyAntSnapshot{1, 0, -2}},
+		Fields:    []*FieldSnapshot{&FieldSnapshot{"explore", []string{"nnnnn", "", "ss"}}},
+	}
+
+	var out bytes.Buffer
+	viewer := &Viewer{&out, "explore"}
+	viewer.Draw(frame)
+
+	lines := strings.Split(out.String(), "\n")
+	if len(lines) < 3 {
+		t.Fatalf("drew %q", out.String())
+	}
+	if !strings.Contains(lines[1], ">") || !strings.Contains(lines[2], "o") {
+		t.Errorf("ants not drawn:\n%v", out.String())
+	}
+}
+
+// TestDrawNegativeSize draws a snapshot whose map has no squares, which
+// should give just the header and the legend
+func TestDrawNegativeSize(t *testing.T) {
+	var out bytes.Buffer
+	viewer := &Viewer{&out, ""}
+	viewer.Draw(&Snapshot{Rows: -1, Cols: 4, Terrain: []string{"...."}, Ants: []*AntSnapshot{&AntSnapshot{0, 0, 1, -1, nil}}})
+
+	lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "turn ") || !strings.Contains(lines[0], "1 ants") ||
+		!strings.Contains(lines[1], "water") {
+		t.Errorf("drew %q", out.String())
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+)
+
+// Visibility counts how many of our ants can see each square, in a flat
+// array indexed by Location. Each turn it's updated from the ants' moves
+// rather than rebuilt: an ant that stepped one square only gains and
+// loses the thin crescents at the edge of its view. The squares whose
+// visibility changed are indexed so nothing has to walk the whole map.
+type Visibility struct {
+	state      *State
+	mask       []*Offset
+	enter      map[Direction][]*Offset
+	leave      map[Direction][]*Offset
+	viewers    []int
+	viewedFrom map[int]*Square
+
+	// scratch space for working out what changed during an update
+	touched    []Location
+	isTouched  []bool
+	wasVisible []bool
+
+	NewlyObserved []*Square // seen for the first time this turn
+	NewlyVisible  []*Square // in view this turn but not last turn
+	NewlyHidden   []*Square // in view last turn but not this turn
+}
+
+func NewVisibility(state *State) *Visibility {
+	size := state.Rows * state.Cols
+	vis := &Visibility{
+		state:      state,
+		mask:       make([]*Offset, 0),
+		enter:      make(map[Direction][]*Offset),
+		leave:      make(map[Direction][]*Offset),
+		viewers:    make([]int, size),
+		viewedFrom: make(map[int]*Square),
+		touched:    make([]Location, 0),
+		isTouched:  make([]bool, size),
+		wasVisible: make([]bool, size),
+	}
+
+	inMask := make(map[Offset]bool)
+	viewRadius := (int)(math.Ceil(math.Sqrt((float64)(state.ViewRadius2))))
+	for rowOffset := -1 * viewRadius; rowOffset <= viewRadius; rowOffset++ {
+		for colOffset := -1 * viewRadius; colOffset <= viewRadius; colOffset++ {
+			if Distance2(state, 0, 0, rowOffset, colOffset) < state.ViewRadius2 {
+				vis.mask = append(vis.mask, &Offset{rowOffset, colOffset})
+				inMask[Offset{rowOffset, colOffset}] = true
+			}
+		}
+	}
+
+	// moving one step in a direction only changes the edges of the mask
+	for direction, step := range Directions {
+		vis.enter[direction] = make([]*Offset, 0)
+		vis.leave[direction] = make([]*Offset, 0)
+		for _, offset := range vis.mask {
+			// relative to the new square, was this visible from the old one?
+			if !inMask[Offset{offset.row + step.row, offset.col + step.col}] {
+				vis.enter[direction] = append(vis.enter[direction], offset)
+			}
+			// relative to the old square, is this visible from the new one?
+			if !inMask[Offset{offset.row - step.row, offset.col - step.col}] {
+				vis.leave[direction] = append(vis.leave[direction], offset)
+			}
+		}
+	}
+
+	return vis
+}
+
+func (vis *Visibility) IsVisible(square *Square) bool {
+	return vis.viewers[square.location] > 0
+}
+
+// Update moves each ant's view to its current square, drops the views of
+// ants that are gone, and rebuilds the indexes of what changed
+func (vis *Visibility) Update(ants map[int]*Ant) {
+	for id, square := range vis.viewedFrom {
+		if _, alive := ants[id]; !alive {
+			vis.apply(square, vis.mask, -1)
+			vis.viewedFrom[id] = nil, false
+		}
+	}
+
+	for id, ant := range ants {
+		square := ant.square
+		previous, seen := vis.viewedFrom[id]
+		if !seen {
+			vis.apply(square, vis.mask, 1)
+		} else if previous != square {
+			direction, adjacent := vis.step(previous, square)
+			if adjacent {
+				vis.apply(previous, vis.leave[direction], -1)
+				vis.apply(square, vis.enter[direction], 1)
+			} else {
+				vis.apply(previous, vis.mask, -1)
+				vis.apply(square, vis.mask, 1)
+			}
+		}
+
+		vis.viewedFrom[id] = square
+		square.visited = true
+	}
+
+	vis.NewlyObserved = make([]*Square, 0)
+	vis.NewlyVisible = make([]*Square, 0)
+	vis.NewlyHidden = make([]*Square, 0)
+	for _, loc := range vis.touched {
+		vis.isTouched[loc] = false
+
+		visible := vis.viewers[loc] > 0
+		square := vis.state.SquareAtLocation(loc)
+		if square.IsWater() {
+			// nothing happens on water, but remember we've seen it
+			if visible && !square.observed {
+				square.Observe(vis.state)
+			}
+			continue
+		}
+		if visible == vis.wasVisible[loc] {
+			continue
+		}
+
+		if !visible {
+			vis.NewlyHidden = append(vis.NewlyHidden, square)
+			continue
+		}
+
+		vis.NewlyVisible = append(vis.NewlyVisible, square)
+		if !square.observed {
+			square.Observe(vis.state)
+			vis.NewlyObserved = append(vis.NewlyObserved, square)
+		}
+	}
+	vis.touched = vis.touched[:0]
+}
+
+func (vis *Visibility) apply(origin *Square, offsets []*Offset, delta int) {
+	for _, offset := range offsets {
+		loc := AddOffsetToLocation(vis.state, offset, origin.location)
+		if !vis.isTouched[loc] {
+			vis.isTouched[loc] = true
+			vis.wasVisible[loc] = vis.viewers[loc] > 0
+			vis.touched = append(vis.touched, loc)
+		}
+		vis.viewers[loc] += delta
+	}
+}
+
+func (vis *Visibility) step(from, to *Square) (Direction, bool) {
+	for direction, offset := range Directions {
+		if AddOffsetToLocation(vis.state, offset, from.location) == to.location {
+			return direction, true
+		}
+	}
+
+	return NoMovement, false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"rand"
+	"testing"
+)
+
+// antWalk is where each of count ants stands on each of turns turns: they
+// start on random land and take random steps, now and then jumping
+// somewhere else entirely (as when an ant dies and another spawns)
+func antWalk(s *State, count, turns int, seed int64) [][]*Square {
+	random := rand.New(rand.NewSource(seed))
+	land := landSquares(s)
+
+	walk := make([][]*Square, turns)
+	for turn := range walk {
+		walk[turn] = make([]*Square, count)
+		for i := range walk[turn] {
+			if turn == 0 || random.Intn(20) == 0 {
+				walk[turn][i] = land[random.Intn(len(land))]
+				continue
+			}
+
+			square := walk[turn-1][i]
+			next := square
+			if random.Intn(4) != 0 {
+				direction := (Direction)(random.Intn(4))
+				next = s.SquareAtLocation(AddOffsetToLocation(s, Directions[direction], square.location))
+			}
+			if !isLand(next) {
+				next = square
+			}
+			walk[turn][i] = next
+		}
+	}
+	return walk
+}
+
+// walkAnts puts the ants where the walk has them on turn
+func walkAnts(ants map[int]*Ant, walk [][]*Square, turn int) {
+	for i, square := range walk[turn] {
+		ant, ok := ants[i]
+		if !ok {
+			ant = &Ant{id: i}
+			ants[i] = ant
+		}
+		ant.square = square
+	}
+}
+
+func TestVisibilityMatchesRecompute(t *testing.T) {
+	s := randomState(30, 35, 0.2, 3)
+	vis := NewVisibility(s)
+	walk := antWalk(s, 20, 200, 4)
+	ants := make(map[int]*Ant)
+	visible := make(map[*Square]bool)
+
+	for turn := range walk {
+		walkAnts(ants, walk, turn)
+		// some ants die for good
+		if turn%10 == 9 {
+			ants[turn%20] = nil, false
+		}
+		vis.Update(ants)
+
+		newlyVisible := make(map[*Square]bool)
+		for _, square := range vis.NewlyVisible {
+			newlyVisible[square] = true
+		}
+		newlyHidden := make(map[*Square]bool)
+		for _, square := range vis.NewlyHidden {
+			newlyHidden[square] = true
+		}
+
+		for _, square := range landSquares(s) {
+			want := false
+			for _, ant := range ants {
+				if Distance2(s, ant.square.location.Row(s), ant.square.location.Col(s), square.location.Row(s), square.location.Col(s)) < s.ViewRadius2 {
+					want = true
+				}
+			}
+
+			if vis.IsVisible(square) != want {
+				t.Fatalf("turn %v: %v visible is %v, expected %v", turn, square, vis.IsVisible(square), want)
+			}
+			if newlyVisible[square] != (want && !visible[square]) {
+				t.Fatalf("turn %v: %v newly visible is %v, expected %v", turn, square, newlyVisible[square], want && !visible[square])
+			}
+			if newlyHidden[square] != (!want && visible[square]) {
+				t.Fatalf("turn %v: %v newly hidden is %v, expected %v", turn, square, newlyHidden[square], !want && visible[square])
+			}
+			visible[square] = want
+		}
+	}
+}
+
+const benchmarkTurns = 100
+
+func BenchmarkVisibilityIncremental(b *testing.B) {
+	b.StopTimer()
+	s := randomState(200, 200, 0.1, 5)
+	walk := antWalk(s, 400, benchmarkTurns, 6)
+	ants := make(map[int]*Ant)
+	vis := NewVisibility(s)
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		walkAnts(ants, walk, i%benchmarkTurns)
+		vis.Update(ants)
+	}
+}
+
+// BenchmarkVisibilityRecompute forgets every ant's view each turn, so
+// each ant's whole view is counted again
+func BenchmarkVisibilityRecompute(b *testing.B) {
+	b.StopTimer()
+	s := randomState(200, 200, 0.1, 5)
+	walk := antWalk(s, 400, benchmarkTurns, 6)
+	ants := make(map[int]*Ant)
+	vis := NewVisibility(s)
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		walkAnts(ants, walk, i%benchmarkTurns)
+		for loc := range vis.viewers {
+			vis.viewers[loc] = 0
+		}
+		vis.viewedFrom = make(map[int]*Square)
+		vis.Update(ants)
+	}
+}